@@ -0,0 +1,97 @@
+// mdbgen 从数据库导出表结构sql文件和go结构体
+//
+//	mdbgen -dsn "user:pass@tcp(127.0.0.1:3306)/db" -sql schema.sql -out model -pkg model -exclude "log_*"
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moremorefun/mtool/mdb"
+	"github.com/moremorefun/mtool/mdbdiff"
+	"github.com/moremorefun/mtool/mlog"
+)
+
+func main() {
+	dsn := flag.String("dsn", "", "数据库链接")
+	sqlPath := flag.String("sql", "", "sql文件路径,为空时不导出")
+	outDir := flag.String("out", "", "go文件目录,为空时不生成")
+	pkg := flag.String("pkg", "", "go包名,默认为目录名")
+	include := flag.String("include", "", "包含的表,逗号分隔的 glob")
+	exclude := flag.String("exclude", "", "排除的表,逗号分隔的 glob")
+	flag.Parse()
+
+	if len(*dsn) == 0 || (len(*sqlPath) == 0 && len(*outDir) == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	filter := mdbdiff.Filter{
+		Include: splitPatterns(*include),
+		Exclude: splitPatterns(*exclude),
+	}
+
+	ctx := context.Background()
+	db, err := mdb.Open(ctx, *dsn, mdb.Options{
+		MaxOpenConns: 1,
+	})
+	if err != nil {
+		mlog.Log.Fatalf("%s", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if len(*sqlPath) > 0 {
+		schema, err := mdbdiff.DumpSchema(ctx, db, filter)
+		if err != nil {
+			mlog.Log.Fatalf("dump schema error: %s", err.Error())
+		}
+		err = ioutil.WriteFile(*sqlPath, []byte(schema), 0644)
+		if err != nil {
+			mlog.Log.Fatalf("write sql error: %s", err.Error())
+		}
+		mlog.Log.Infof("write sql: %s", *sqlPath)
+	}
+
+	if len(*outDir) > 0 {
+		if len(*pkg) == 0 {
+			absDir, err := filepath.Abs(*outDir)
+			if err != nil {
+				mlog.Log.Fatalf("out dir error: %s", err.Error())
+			}
+			*pkg = strings.ReplaceAll(strings.ToLower(filepath.Base(absDir)), "-", "_")
+		}
+		files, err := mdbdiff.GenStructs(ctx, db, *pkg, filter)
+		if err != nil {
+			mlog.Log.Fatalf("gen structs error: %s", err.Error())
+		}
+		err = os.MkdirAll(*outDir, 0755)
+		if err != nil {
+			mlog.Log.Fatalf("make dir error: %s", err.Error())
+		}
+		for name, code := range files {
+			filePath := filepath.Join(*outDir, name)
+			err = ioutil.WriteFile(filePath, code, 0644)
+			if err != nil {
+				mlog.Log.Fatalf("write go error: %s", err.Error())
+			}
+			mlog.Log.Infof("write go: %s", filePath)
+		}
+	}
+}
+
+// splitPatterns 拆分逗号分隔的 glob
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) > 0 {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,442 @@
+package mdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/moremorefun/mtool/mlog"
+)
+
+// 从库负载均衡方式
+const (
+	BalanceRoundRobin       = 1
+	BalanceLeastConnections = 2
+)
+
+// ClusterConfig 主从集群配置
+type ClusterConfig struct {
+	PrimaryDSN  string
+	ReplicaDSNs []string
+	// Balance 负载均衡方式,默认轮询
+	Balance int64
+	// HealthCheckInterval 健康检查间隔,默认5s
+	HealthCheckInterval time.Duration
+	// MaxReplicaLag 最大复制延迟,超过时从库被剔除,0 不检查延迟
+	MaxReplicaLag time.Duration
+	// Options 链接选项
+	Options Options
+}
+
+// replica 从库
+type replica struct {
+	healthy int32
+	db      *sqlx.DB
+}
+
+// Cluster 主从集群,实现 ExecuteAble
+// 读语句发送到健康的从库,写语句、加锁读和事务使用主库
+type Cluster struct {
+	next     uint64
+	primary  *sqlx.DB
+	replicas []*replica
+	conf     ClusterConfig
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// primaryCtxKey 强制主库标记
+type primaryCtxKey struct{}
+
+// WithPrimary 在 ctx 中标记读语句也使用主库,用于写后立即读
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// isForcePrimary 是否强制主库
+func isForcePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return v
+}
+
+// CreateCluster 创建主从集群
+// 主库不可用时返回错误,从库不可用时先剔除,健康检查通过后加入
+func CreateCluster(ctx context.Context, conf ClusterConfig) (*Cluster, error) {
+	primary, err := Open(ctx, conf.PrimaryDSN, conf.Options)
+	if err != nil {
+		return nil, err
+	}
+	var replicaDBs []*sqlx.DB
+	for _, dsn := range conf.ReplicaDSNs {
+		db, err := openDB(dsn, conf.Options)
+		if err != nil {
+			_ = primary.Close()
+			for _, replicaDB := range replicaDBs {
+				_ = replicaDB.Close()
+			}
+			return nil, err
+		}
+		replicaDBs = append(replicaDBs, db)
+	}
+	return NewCluster(primary, replicaDBs, conf), nil
+}
+
+// NewCluster 使用已有链接创建主从集群, conf 中的 DSN 不生效
+// 从库在第一次健康检查通过后才会使用
+func NewCluster(primary *sqlx.DB, replicaDBs []*sqlx.DB, conf ClusterConfig) *Cluster {
+	if conf.Balance == 0 {
+		conf.Balance = BalanceRoundRobin
+	}
+	if conf.HealthCheckInterval <= 0 {
+		conf.HealthCheckInterval = 5 * time.Second
+	}
+	c := &Cluster{
+		primary: primary,
+		conf:    conf,
+		stop:    make(chan struct{}),
+	}
+	for _, db := range replicaDBs {
+		c.replicas = append(c.replicas, &replica{
+			db: db,
+		})
+	}
+	if len(c.replicas) > 0 {
+		c.CheckReplicas(context.Background())
+		go c.healthLoop()
+	}
+	return c
+}
+
+// Primary 主库
+func (c *Cluster) Primary() *sqlx.DB {
+	return c.primary
+}
+
+// Close 关闭所有链接
+func (c *Cluster) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	for _, r := range c.replicas {
+		_ = r.db.Close()
+	}
+	return c.primary.Close()
+}
+
+// healthLoop 定时检查从库
+func (c *Cluster) healthLoop() {
+	ticker := time.NewTicker(c.conf.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.CheckReplicas(context.Background())
+		}
+	}
+}
+
+// CheckReplicas 检查从库状态,不健康的从库被剔除,恢复后重新加入
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	for i, r := range c.replicas {
+		err := c.checkReplica(ctx, r)
+		if err != nil {
+			if atomic.SwapInt32(&r.healthy, 0) == 1 {
+				mlog.Log.Warnf("db replica %d ejected: %s", i, err.Error())
+			}
+			continue
+		}
+		if atomic.SwapInt32(&r.healthy, 1) == 0 {
+			mlog.Log.Infof("db replica %d recovered", i)
+		}
+	}
+}
+
+// checkReplica 检查单个从库
+func (c *Cluster) checkReplica(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, c.conf.HealthCheckInterval)
+	defer cancel()
+	err := r.db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+	if c.conf.MaxReplicaLag <= 0 {
+		return nil
+	}
+	lag, err := replicaLag(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	if lag > c.conf.MaxReplicaLag {
+		return fmt.Errorf("replica lag %s > %s", lag, c.conf.MaxReplicaLag)
+	}
+	return nil
+}
+
+// replicaLag 获取复制延迟
+func replicaLag(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		// 不是从库
+		return 0, rows.Err()
+	}
+	values := make([]sql.RawBytes, len(columns))
+	points := make([]interface{}, len(columns))
+	for i := range values {
+		points[i] = &values[i]
+	}
+	err = rows.Scan(points...)
+	if err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, fmt.Errorf("replication not running")
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, fmt.Errorf("no Seconds_Behind_Master")
+}
+
+// pickReplica 选择从库,没有健康从库时返回nil
+func (c *Cluster) pickReplica() *replica {
+	l := len(c.replicas)
+	if l == 0 {
+		return nil
+	}
+	if c.conf.Balance == BalanceLeastConnections {
+		// 使用中的链接数,包含未关闭的 Rows
+		var picked *replica
+		pickedInUse := 0
+		for _, r := range c.replicas {
+			if atomic.LoadInt32(&r.healthy) == 0 {
+				continue
+			}
+			inUse := r.db.Stats().InUse
+			if picked == nil || inUse < pickedInUse {
+				picked = r
+				pickedInUse = inUse
+			}
+		}
+		return picked
+	}
+	start := atomic.AddUint64(&c.next, 1)
+	for i := 0; i < l; i++ {
+		r := c.replicas[(start+uint64(i))%uint64(l)]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+// sessionFuncs 依赖会话状态的函数,语句需要在主库执行
+var sessionFuncs = map[string]bool{
+	"GET_LOCK":          true,
+	"RELEASE_LOCK":      true,
+	"RELEASE_ALL_LOCKS": true,
+	"IS_FREE_LOCK":      true,
+	"IS_USED_LOCK":      true,
+	"LAST_INSERT_ID":    true,
+	"FOUND_ROWS":        true,
+	"ROW_COUNT":         true,
+	"CONNECTION_ID":     true,
+}
+
+// isReadQuery 是否可以发送到从库
+// 加锁读、读取会话变量和依赖会话状态的函数使用主库
+func isReadQuery(query string) bool {
+	words := queryWords(query)
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "SELECT":
+	case "WITH":
+		// WITH 后面也可能是 UPDATE DELETE
+		if mainStatement(strings.ToUpper(query)) != "SELECT" {
+			return false
+		}
+	default:
+		return false
+	}
+	for i, word := range words {
+		if strings.HasPrefix(word, "@") || sessionFuncs[word] {
+			return false
+		}
+		if word == "FOR" && i+1 < len(words) && (words[i+1] == "UPDATE" || words[i+1] == "SHARE") {
+			return false
+		}
+		if word == "LOCK" && i+3 < len(words) && words[i+1] == "IN" && words[i+2] == "SHARE" && words[i+3] == "MODE" {
+			return false
+		}
+	}
+	return true
+}
+
+// queryWords 字符串、标识符引号和注释之外的单词,转为大写
+// @var @@session.var 作为一个单词
+func queryWords(query string) []string {
+	var words []string
+	q := strings.ToUpper(query)
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(q) && q[i] != c; i++ {
+				if q[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "-- ")):
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			end := strings.Index(q[i+2:], "*/")
+			if end < 0 {
+				return words
+			}
+			i += end + 3
+		case c == '@' || c == '_' || (c >= 'A' && c <= 'Z'):
+			j := i
+			for j < len(q) && (q[j] == '@' || q[j] == '_' || q[j] == '$' || q[j] == '.' || (q[j] >= 'A' && q[j] <= 'Z') || (q[j] >= '0' && q[j] <= '9')) {
+				j++
+			}
+			words = append(words, strings.Trim(q[i:j], "."))
+			i = j - 1
+		}
+	}
+	return words
+}
+
+// mainStatement WITH 语句中 CTE 列表之后的主语句关键字
+func mainStatement(q string) string {
+	depth := 0
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 跳过字符串和标识符
+			for i++; i < len(q) && q[i] != c; i++ {
+				if q[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(q) && (q[j] == '_' || (q[j] >= 'A' && q[j] <= 'Z') || (q[j] >= '0' && q[j] <= '9')) {
+				j++
+			}
+			switch word := q[i:j]; word {
+			case "SELECT", "UPDATE", "DELETE", "INSERT", "REPLACE", "TABLE", "VALUES":
+				return word
+			}
+			i = j - 1
+		}
+	}
+	return ""
+}
+
+// route 选择执行的链接
+func (c *Cluster) route(ctx context.Context, query string) *sqlx.DB {
+	if isForcePrimary(ctx) || !isReadQuery(query) {
+		return c.primary
+	}
+	r := c.pickReplica()
+	if r == nil {
+		return c.primary
+	}
+	return r.db
+}
+
+// beginTx 事务使用主库
+func (c *Cluster) beginTx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, ExecuteAble, error) {
+	tx, err := c.primary.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, tx, nil
+}
+
+// DriverName 驱动名称
+func (c *Cluster) DriverName() string {
+	return c.primary.DriverName()
+}
+
+// Rebind 转换参数占位符
+func (c *Cluster) Rebind(query string) string {
+	return c.primary.Rebind(query)
+}
+
+// Get 获取单行
+func (c *Cluster) Get(dest interface{}, query string, args ...interface{}) error {
+	return c.GetContext(context.Background(), dest, query, args...)
+}
+
+// Exec 执行
+func (c *Cluster) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+// Select 获取多行
+func (c *Cluster) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.SelectContext(context.Background(), dest, query, args...)
+}
+
+// GetContext 获取单行
+func (c *Cluster) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db := c.route(ctx, query)
+	return db.GetContext(ctx, dest, query, args...)
+}
+
+// ExecContext 执行,总是使用主库
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.primary.ExecContext(ctx, query, args...)
+}
+
+// SelectContext 获取多行
+func (c *Cluster) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db := c.route(ctx, query)
+	return db.SelectContext(ctx, dest, query, args...)
+}
+
+// QueryContext 查询
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db := c.route(ctx, query)
+	return db.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext 查询单行
+func (c *Cluster) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	db := c.route(ctx, query)
+	return db.QueryRowContext(ctx, query, args...)
+}
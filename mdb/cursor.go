@@ -0,0 +1,86 @@
+package mdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cursor 逐行读取的游标,使用完成后需要 Close
+type Cursor struct {
+	rows    *sql.Rows
+	scanner *RowScanner
+	err     error
+	// closeRows 关闭 rows 并结束拦截器
+	closeRows func(readErr error) error
+}
+
+// CursorContent 执行sql查询并返回游标
+// ctx 取消时 Next 返回 false, Err 返回 ctx 的错误
+func CursorContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H) (*Cursor, error) {
+	query, args, err := wrapSQL(query, argMap, tx)
+	if err != nil {
+		return nil, err
+	}
+	rows, closeRows, err := cursorIntercept(ctx, tx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := NewRowScanner(rows)
+	if err != nil {
+		_ = closeRows(err)
+		return nil, err
+	}
+	return &Cursor{
+		rows:      rows,
+		scanner:   scanner,
+		closeRows: closeRows,
+	}, nil
+}
+
+// Typed Map 中 DECIMAL 返回 Decimal, JSON 返回解析后的值
+func (c *Cursor) Typed() *Cursor {
+	c.scanner.Typed()
+	return c
+}
+
+// Columns 字段名
+func (c *Cursor) Columns() []string {
+	return c.scanner.Columns()
+}
+
+// Next 读取下一行,没有数据或出错时返回 false
+func (c *Cursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if !c.rows.Next() {
+		return false
+	}
+	c.err = c.scanner.Scan(c.rows)
+	return c.err == nil
+}
+
+// Map 当前行转换为map
+func (c *Cursor) Map() (gin.H, error) {
+	return c.scanner.Map()
+}
+
+// Scan 当前行按db标签写入结构体
+func (c *Cursor) Scan(dest interface{}) error {
+	return c.scanner.Struct(dest)
+}
+
+// Err 迭代中的错误
+func (c *Cursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.rows.Err()
+}
+
+// Close 关闭游标,迭代中有错误时也返回该错误
+func (c *Cursor) Close() error {
+	return c.closeRows(c.Err())
+}
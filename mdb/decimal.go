@@ -0,0 +1,108 @@
+package mdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+// Decimal 定点数,对应 DECIMAL 字段,以字符串形式保存原始精度
+type Decimal struct {
+	s string
+}
+
+// decimalRegexp 定点数格式,不支持分数和指数
+var decimalRegexp = regexp.MustCompile(`^[+-]?\d+(\.\d+)?$`)
+
+// DecimalMake 生成, s 为 123 -1.50 格式的十进制数
+func DecimalMake(s string) (Decimal, error) {
+	if !decimalRegexp.MatchString(s) {
+		return Decimal{}, fmt.Errorf("decimal format error: %s", s)
+	}
+	_, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("decimal parse error: %s", s)
+	}
+	return Decimal{s: s}, nil
+}
+
+// String 字符串
+func (d Decimal) String() string {
+	if len(d.s) == 0 {
+		return "0"
+	}
+	return d.s
+}
+
+// Rat 转换为有理数
+func (d Decimal) Rat() *big.Rat {
+	r, ok := new(big.Rat).SetString(d.String())
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// Float64 转换为浮点数,可能丢失精度
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// Scan 实现 sql.Scanner
+func (d *Decimal) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		d.s = ""
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("decimal scan type error: %T", src)
+	}
+	nd, err := DecimalMake(s)
+	if err != nil {
+		return err
+	}
+	*d = nd
+	return nil
+}
+
+// Value 实现 driver.Valuer
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON 以字符串输出,避免丢失精度
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON 支持字符串和数字
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		d.s = ""
+		return nil
+	}
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	nd, err := DecimalMake(s)
+	if err != nil {
+		return err
+	}
+	*d = nd
+	return nil
+}
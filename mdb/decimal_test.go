@@ -0,0 +1,79 @@
+package mdb
+
+import (
+	"testing"
+)
+
+func TestDecimalMake(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		isError bool
+	}{
+		{name: "integer", s: "123", want: "123"},
+		{name: "fraction", s: "-1.50", want: "-1.50"},
+		{name: "plus", s: "+0.1", want: "+0.1"},
+		{name: "long", s: "12345678901234567890.123456789", want: "12345678901234567890.123456789"},
+		{name: "empty", s: "", isError: true},
+		{name: "rational", s: "1/3", isError: true},
+		{name: "exponent", s: "1e10", isError: true},
+		{name: "no integer part", s: ".5", isError: true},
+		{name: "no fraction part", s: "5.", isError: true},
+		{name: "space", s: " 1", isError: true},
+		{name: "word", s: "abc", isError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := DecimalMake(tt.s)
+			if tt.isError {
+				if err == nil {
+					t.Fatalf("DecimalMake(%q) want error, got %s", tt.s, d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecimalMake(%q) error: %s", tt.s, err)
+			}
+			if d.String() != tt.want {
+				t.Errorf("DecimalMake(%q) = %s, want %s", tt.s, d, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    string
+		isError bool
+	}{
+		{name: "nil", src: nil, want: "0"},
+		{name: "bytes", src: []byte("10.25"), want: "10.25"},
+		{name: "string", src: "-3", want: "-3"},
+		{name: "int64", src: int64(42), want: "42"},
+		{name: "uint64", src: uint64(18446744073709551615), want: "18446744073709551615"},
+		{name: "float64", src: 0.5, want: "0.5"},
+		{name: "bad string", src: "1e3", isError: true},
+		{name: "bad type", src: true, isError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Decimal
+			err := d.Scan(tt.src)
+			if tt.isError {
+				if err == nil {
+					t.Fatalf("Scan(%v) want error", tt.src)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan(%v) error: %s", tt.src, err)
+			}
+			if d.String() != tt.want {
+				t.Errorf("Scan(%v) = %s, want %s", tt.src, d, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package mdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/moremorefun/mtool/mlog"
+	"go.uber.org/zap"
+)
+
+// 执行类型
+const (
+	OpExec   = "exec"
+	OpGet    = "get"
+	OpSelect = "select"
+	OpQuery  = "query"
+	// 事务语句,保存点语句为 OpExec
+	OpBegin    = "begin"
+	OpCommit   = "commit"
+	OpRollback = "rollback"
+)
+
+// QueryInfo 执行信息
+// 调用 next 之前只有 Op Query Args 有值, next 返回后填充 Duration RowsAffected Err
+type QueryInfo struct {
+	Op    string
+	Query string
+	Args  []interface{}
+	// DriverName 驱动名称,如 mysql postgres sqlite3
+	DriverName string
+	// Duration 执行耗时,不含拦截器, query 包含读取结果的时间
+	Duration time.Duration
+	// RowsAffected 影响行数,只在 exec 时有效,其它为 -1
+	RowsAffected int64
+	Err          error
+}
+
+// IsErr 是否执行错误, sql.ErrNoRows 不算错误
+func (info *QueryInfo) IsErr() bool {
+	return info.Err != nil && info.Err != sql.ErrNoRows
+}
+
+// Interceptor 拦截器,必须调用 next 执行, next 可以传入新的 ctx
+type Interceptor func(ctx context.Context, info *QueryInfo, next func(ctx context.Context) error) error
+
+var (
+	interceptorMutex sync.Mutex
+	interceptors     atomic.Value
+)
+
+// AddInterceptor 添加拦截器,先添加的在外层,在程序启动时设置
+// 拦截器作用于 ExecuteContent GetContent SelectContent RowsContent ScanContent CursorContent 等执行函数,
+// 以及 Transaction 中的 BEGIN COMMIT ROLLBACK 和保存点语句
+// CursorContent 的拦截器在游标 Close 时返回
+func AddInterceptor(is ...Interceptor) {
+	interceptorMutex.Lock()
+	defer interceptorMutex.Unlock()
+	old := getInterceptors()
+	chain := make([]Interceptor, 0, len(old)+len(is))
+	chain = append(chain, old...)
+	chain = append(chain, is...)
+	interceptors.Store(chain)
+}
+
+// ResetInterceptors 清空拦截器
+func ResetInterceptors() {
+	interceptorMutex.Lock()
+	defer interceptorMutex.Unlock()
+	interceptors.Store([]Interceptor(nil))
+}
+
+// getInterceptors 获取拦截器
+func getInterceptors() []Interceptor {
+	chain, _ := interceptors.Load().([]Interceptor)
+	return chain
+}
+
+// intercept 通过拦截器执行 f, f 返回影响行数
+func intercept(ctx context.Context, tx ExecuteAble, op, query string, args []interface{}, f func(ctx context.Context) (int64, error)) error {
+	chain := getInterceptors()
+	if len(chain) == 0 {
+		_, err := f(ctx)
+		return err
+	}
+	info := &QueryInfo{
+		Op:           op,
+		Query:        query,
+		Args:         args,
+		DriverName:   driverName(tx),
+		RowsAffected: -1,
+	}
+	var call func(ctx context.Context, i int) error
+	call = func(ctx context.Context, i int) error {
+		if i == len(chain) {
+			start := time.Now()
+			rowsAffected, err := f(ctx)
+			info.Duration = time.Since(start)
+			info.RowsAffected = rowsAffected
+			info.Err = err
+			return err
+		}
+		return chain[i](ctx, info, func(ctx context.Context) error {
+			return call(ctx, i+1)
+		})
+	}
+	return call(ctx, 0)
+}
+
+// driverName 获取驱动名称,无法获取时返回空
+func driverName(tx ExecuteAble) string {
+	switch v := tx.(type) {
+	case *Tx:
+		return v.tx.DriverName()
+	case interface{ DriverName() string }:
+		return v.DriverName()
+	}
+	return ""
+}
+
+// execIntercept 通过拦截器执行 exec
+func execIntercept(ctx context.Context, tx ExecuteAble, query string, args []interface{}) (sql.Result, error) {
+	var ret sql.Result
+	err := intercept(ctx, tx, OpExec, query, args, func(ctx context.Context) (int64, error) {
+		var err error
+		ret, err = tx.ExecContext(
+			ctx,
+			query,
+			args...,
+		)
+		if err != nil {
+			return -1, err
+		}
+		rowsAffected, err := ret.RowsAffected()
+		if err != nil {
+			return -1, nil
+		}
+		return rowsAffected, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// queryIntercept 通过拦截器执行 query, read 读取完成后关闭 rows
+func queryIntercept(ctx context.Context, tx ExecuteAble, query string, args []interface{}, read func(rows *sql.Rows) error) error {
+	return intercept(ctx, tx, OpQuery, query, args, func(ctx context.Context) (int64, error) {
+		rows, err := tx.QueryContext(
+			ctx,
+			query,
+			args...,
+		)
+		if err != nil {
+			return -1, err
+		}
+		defer func() {
+			_ = rows.Close()
+		}()
+		err = read(rows)
+		if err != nil {
+			return -1, err
+		}
+		return -1, rows.Close()
+	})
+}
+
+// cursorIntercept 通过拦截器执行游标查询
+// 拦截器在协程中执行,查询完成后等待 closeRows, 传入读取中的错误并关闭 rows 后返回
+func cursorIntercept(ctx context.Context, tx ExecuteAble, query string, args []interface{}) (*sql.Rows, func(readErr error) error, error) {
+	if len(getInterceptors()) == 0 {
+		rows, err := tx.QueryContext(
+			ctx,
+			query,
+			args...,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rows, func(readErr error) error {
+			err := rows.Close()
+			if readErr != nil {
+				return readErr
+			}
+			return err
+		}, nil
+	}
+	var rows *sql.Rows
+	opened := make(chan struct{})
+	closed := make(chan error, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- intercept(ctx, tx, OpQuery, query, args, func(ctx context.Context) (int64, error) {
+			var err error
+			rows, err = tx.QueryContext(
+				ctx,
+				query,
+				args...,
+			)
+			close(opened)
+			if err != nil {
+				return -1, err
+			}
+			readErr := <-closed
+			err = rows.Close()
+			if readErr != nil {
+				return -1, readErr
+			}
+			return -1, err
+		})
+	}()
+	select {
+	case <-opened:
+		if rows == nil {
+			return nil, nil, <-done
+		}
+	case err := <-done:
+		if err == nil {
+			err = fmt.Errorf("query interceptor not call next")
+		}
+		return nil, nil, err
+	}
+	var once sync.Once
+	var closeErr error
+	return rows, func(readErr error) error {
+		once.Do(func() {
+			closed <- readErr
+			closeErr = <-done
+		})
+		return closeErr
+	}, nil
+}
+
+// SlowLogInterceptor 慢查询日志,耗时大于等于 threshold 时输出警告
+func SlowLogInterceptor(threshold time.Duration) Interceptor {
+	return func(ctx context.Context, info *QueryInfo, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		if info.Duration >= threshold {
+			fields := []zap.Field{
+				zap.Duration("duration", info.Duration),
+				zap.String("op", info.Op),
+			}
+			fields = append(fields, SQLFields(info.Query, info.Args)...)
+			mlog.ZapLog.Warn("slow sql", fields...)
+		}
+		return err
+	}
+}
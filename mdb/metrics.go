@@ -0,0 +1,210 @@
+package mdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultMetricsBuckets 默认耗时分布,单位秒
+var DefaultMetricsBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// metricKey 计数标签
+type metricKey struct {
+	op     string
+	status string
+}
+
+// histogram 耗时分布
+type histogram struct {
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// Metrics 进程内指标,按执行类型和状态统计次数、影响行数和耗时分布
+type Metrics struct {
+	mutex        sync.Mutex
+	buckets      []float64
+	counters     map[metricKey]int64
+	rowsAffected map[string]int64
+	histograms   map[string]*histogram
+}
+
+// MetricsCounter 计数
+type MetricsCounter struct {
+	Op     string
+	Status string
+	Value  int64
+}
+
+// MetricsHistogram 耗时分布, Counts 为小于等于对应 Buckets 的累计次数
+type MetricsHistogram struct {
+	Op      string
+	Buckets []float64
+	Counts  []int64
+	Sum     float64
+	Count   int64
+}
+
+// MetricsSnapshot 指标快照
+type MetricsSnapshot struct {
+	Counters     []MetricsCounter
+	RowsAffected map[string]int64
+	Histograms   []MetricsHistogram
+}
+
+// 执行状态
+const (
+	MetricsStatusOk    = "ok"
+	MetricsStatusError = "error"
+)
+
+// NewMetrics 创建指标, buckets 为空时使用 DefaultMetricsBuckets
+func NewMetrics(buckets []float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	bs := make([]float64, len(buckets))
+	copy(bs, buckets)
+	sort.Float64s(bs)
+	return &Metrics{
+		buckets:      bs,
+		counters:     map[metricKey]int64{},
+		rowsAffected: map[string]int64{},
+		histograms:   map[string]*histogram{},
+	}
+}
+
+// Interceptor 统计拦截器
+func (m *Metrics) Interceptor() Interceptor {
+	return func(ctx context.Context, info *QueryInfo, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		m.Observe(info)
+		return err
+	}
+}
+
+// Observe 记录一次执行
+func (m *Metrics) Observe(info *QueryInfo) {
+	status := MetricsStatusOk
+	if info.IsErr() {
+		status = MetricsStatusError
+	}
+	seconds := info.Duration.Seconds()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters[metricKey{op: info.Op, status: status}]++
+	if info.RowsAffected > 0 {
+		m.rowsAffected[info.Op] += info.RowsAffected
+	}
+	h, ok := m.histograms[info.Op]
+	if !ok {
+		h = &histogram{
+			counts: make([]int64, len(m.buckets)),
+		}
+		m.histograms[info.Op] = h
+	}
+	for i, bucket := range m.buckets {
+		if seconds <= bucket {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Snapshot 获取快照,按执行类型排序
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	snapshot := MetricsSnapshot{
+		RowsAffected: map[string]int64{},
+	}
+	for k, v := range m.counters {
+		snapshot.Counters = append(snapshot.Counters, MetricsCounter{
+			Op:     k.op,
+			Status: k.status,
+			Value:  v,
+		})
+	}
+	sort.Slice(snapshot.Counters, func(i, j int) bool {
+		if snapshot.Counters[i].Op != snapshot.Counters[j].Op {
+			return snapshot.Counters[i].Op < snapshot.Counters[j].Op
+		}
+		return snapshot.Counters[i].Status < snapshot.Counters[j].Status
+	})
+	for k, v := range m.rowsAffected {
+		snapshot.RowsAffected[k] = v
+	}
+	for op, h := range m.histograms {
+		counts := make([]int64, len(h.counts))
+		copy(counts, h.counts)
+		snapshot.Histograms = append(snapshot.Histograms, MetricsHistogram{
+			Op:      op,
+			Buckets: m.buckets,
+			Counts:  counts,
+			Sum:     h.sum,
+			Count:   h.count,
+		})
+	}
+	sort.Slice(snapshot.Histograms, func(i, j int) bool {
+		return snapshot.Histograms[i].Op < snapshot.Histograms[j].Op
+	})
+	return snapshot
+}
+
+// Reset 清空指标
+func (m *Metrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters = map[metricKey]int64{}
+	m.rowsAffected = map[string]int64{}
+	m.histograms = map[string]*histogram{}
+}
+
+// WritePrometheus 按 prometheus 文本格式输出
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snapshot := m.Snapshot()
+	bw := bufio.NewWriter(w)
+
+	_, _ = fmt.Fprintln(bw, "# HELP mdb_queries_total Total number of executed sql.")
+	_, _ = fmt.Fprintln(bw, "# TYPE mdb_queries_total counter")
+	for _, c := range snapshot.Counters {
+		_, _ = fmt.Fprintf(bw, "mdb_queries_total{op=%q,status=%q} %d\n", c.Op, c.Status, c.Value)
+	}
+
+	ops := make([]string, 0, len(snapshot.RowsAffected))
+	for op := range snapshot.RowsAffected {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	_, _ = fmt.Fprintln(bw, "# HELP mdb_rows_affected_total Total number of rows affected.")
+	_, _ = fmt.Fprintln(bw, "# TYPE mdb_rows_affected_total counter")
+	for _, op := range ops {
+		_, _ = fmt.Fprintf(bw, "mdb_rows_affected_total{op=%q} %d\n", op, snapshot.RowsAffected[op])
+	}
+
+	_, _ = fmt.Fprintln(bw, "# HELP mdb_query_duration_seconds Sql execute duration in seconds.")
+	_, _ = fmt.Fprintln(bw, "# TYPE mdb_query_duration_seconds histogram")
+	for _, h := range snapshot.Histograms {
+		for i, bucket := range h.Buckets {
+			_, _ = fmt.Fprintf(
+				bw,
+				"mdb_query_duration_seconds_bucket{op=%q,le=%q} %d\n",
+				h.Op,
+				strconv.FormatFloat(bucket, 'g', -1, 64),
+				h.Counts[i],
+			)
+		}
+		_, _ = fmt.Fprintf(bw, "mdb_query_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", h.Op, h.Count)
+		_, _ = fmt.Fprintf(bw, "mdb_query_duration_seconds_sum{op=%q} %s\n", h.Op, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+		_, _ = fmt.Fprintf(bw, "mdb_query_duration_seconds_count{op=%q} %d\n", h.Op, h.Count)
+	}
+	return bw.Flush()
+}
@@ -2,20 +2,22 @@ package mdb
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"fmt"
-	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/moremorefun/mtool/mlog"
+	"github.com/moremorefun/mtool/mutils"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
-
-	// 导入mysql
-	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
 )
 
 // 数据库数据类型
@@ -25,40 +27,125 @@ const (
 	GoTypeBytes   = 3
 	GoTypeFloat64 = 4
 	GoTypeTime    = 5
+	GoTypeUint64  = 6
+	GoTypeDecimal = 7
+	GoTypeJSON    = 8
+	GoTypeBool    = 9
+	GoTypeAny     = 10
 )
 
 // TypeMySQLToGoMap 类型转换关系
 var TypeMySQLToGoMap = map[string]int64{
-	"BIT":        1,
-	"TEXT":       1,
-	"BLOB":       3,
-	"DATETIME":   5,
-	"DOUBLE":     4,
-	"ENUM":       1,
-	"FLOAT":      4,
-	"GEOMETRY":   1,
-	"MEDIUMINT":  2,
-	"JSON":       1,
-	"INT":        2,
-	"LONGTEXT":   1,
-	"LONGBLOB":   3,
-	"BIGINT":     2,
-	"MEDIUMTEXT": 1,
-	"MEDIUMBLOB": 3,
-	"DATE":       5,
-	"DECIMAL":    1,
-	"SET":        1,
-	"SMALLINT":   2,
-	"BINARY":     3,
-	"CHAR":       1,
-	"TIME":       5,
-	"TIMESTAMP":  5,
-	"TINYINT":    2,
-	"TINYTEXT":   1,
-	"TINYBLOB":   3,
-	"VARBINARY":  3,
-	"VARCHAR":    1,
-	"YEAR":       2,
+	"BIT":                GoTypeString,
+	"TEXT":               GoTypeString,
+	"BLOB":               GoTypeBytes,
+	"DATETIME":           GoTypeTime,
+	"DOUBLE":             GoTypeFloat64,
+	"ENUM":               GoTypeString,
+	"FLOAT":              GoTypeFloat64,
+	"GEOMETRY":           GoTypeString,
+	"MEDIUMINT":          GoTypeInt64,
+	"JSON":               GoTypeJSON,
+	"INT":                GoTypeInt64,
+	"LONGTEXT":           GoTypeString,
+	"LONGBLOB":           GoTypeBytes,
+	"BIGINT":             GoTypeInt64,
+	"MEDIUMTEXT":         GoTypeString,
+	"MEDIUMBLOB":         GoTypeBytes,
+	"DATE":               GoTypeTime,
+	"DECIMAL":            GoTypeDecimal,
+	"SET":                GoTypeString,
+	"SMALLINT":           GoTypeInt64,
+	"BINARY":             GoTypeBytes,
+	"CHAR":               GoTypeString,
+	"TIME":               GoTypeTime,
+	"TIMESTAMP":          GoTypeTime,
+	"TINYINT":            GoTypeInt64,
+	"TINYTEXT":           GoTypeString,
+	"TINYBLOB":           GoTypeBytes,
+	"VARBINARY":          GoTypeBytes,
+	"VARCHAR":            GoTypeString,
+	"YEAR":               GoTypeInt64,
+	"NULL":               GoTypeString,
+	"UNSIGNED TINYINT":   GoTypeInt64,
+	"UNSIGNED SMALLINT":  GoTypeInt64,
+	"UNSIGNED MEDIUMINT": GoTypeInt64,
+	"UNSIGNED INT":       GoTypeInt64,
+	"UNSIGNED BIGINT":    GoTypeUint64,
+}
+
+// TypePostgresToGoMap postgres类型转换关系
+var TypePostgresToGoMap = map[string]int64{
+	"BOOL":        GoTypeBool,
+	"INT2":        GoTypeInt64,
+	"INT4":        GoTypeInt64,
+	"INT8":        GoTypeInt64,
+	"OID":         GoTypeInt64,
+	"FLOAT4":      GoTypeFloat64,
+	"FLOAT8":      GoTypeFloat64,
+	"NUMERIC":     GoTypeDecimal,
+	"MONEY":       GoTypeString,
+	"TEXT":        GoTypeString,
+	"VARCHAR":     GoTypeString,
+	"BPCHAR":      GoTypeString,
+	"CHAR":        GoTypeString,
+	"NAME":        GoTypeString,
+	"UUID":        GoTypeString,
+	"INET":        GoTypeString,
+	"CIDR":        GoTypeString,
+	"MACADDR":     GoTypeString,
+	"BIT":         GoTypeString,
+	"VARBIT":      GoTypeString,
+	"XML":         GoTypeString,
+	"INTERVAL":    GoTypeString,
+	"TIME":        GoTypeString,
+	"TIMETZ":      GoTypeString,
+	"BYTEA":       GoTypeBytes,
+	"DATE":        GoTypeTime,
+	"TIMESTAMP":   GoTypeTime,
+	"TIMESTAMPTZ": GoTypeTime,
+	"JSON":        GoTypeJSON,
+	"JSONB":       GoTypeJSON,
+}
+
+// TypeSQLiteToGoMap sqlite类型转换关系
+var TypeSQLiteToGoMap = map[string]int64{
+	"":          GoTypeAny,
+	"INTEGER":   GoTypeInt64,
+	"INT":       GoTypeInt64,
+	"BIGINT":    GoTypeInt64,
+	"REAL":      GoTypeFloat64,
+	"DOUBLE":    GoTypeFloat64,
+	"FLOAT":     GoTypeFloat64,
+	"NUMERIC":   GoTypeDecimal,
+	"DECIMAL":   GoTypeDecimal,
+	"BOOLEAN":   GoTypeBool,
+	"TEXT":      GoTypeString,
+	"CLOB":      GoTypeString,
+	"VARCHAR":   GoTypeString,
+	"CHAR":      GoTypeString,
+	"BLOB":      GoTypeBytes,
+	"DATE":      GoTypeTime,
+	"DATETIME":  GoTypeTime,
+	"TIMESTAMP": GoTypeTime,
+	"JSON":      GoTypeJSON,
+}
+
+// GoTypeByDBType 根据数据库类型获取go类型
+// 依次查找 mysql postgres sqlite, 忽略类型中的长度定义
+func GoTypeByDBType(dbType string) (int64, bool) {
+	dbType = strings.ToUpper(strings.TrimSpace(dbType))
+	index := strings.Index(dbType, "(")
+	if index != -1 {
+		dbType = strings.TrimSpace(dbType[:index])
+	}
+	for _, m := range []map[string]int64{TypeMySQLToGoMap, TypePostgresToGoMap, TypeSQLiteToGoMap} {
+		goType, ok := m[dbType]
+		if ok {
+			return goType, true
+		}
+	}
+	return 0, false
 }
 
 // ExecuteAble 数据库接口
@@ -80,30 +167,126 @@ type ExecuteAble interface {
 // isShowSQL 是否显示执行的sql语句
 var isShowSQL bool
 
+// Options 数据库链接选项
+type Options struct {
+	// MaxOpenConns 最大链接数,默认 NumCPU*20+1
+	MaxOpenConns int
+	// MaxIdleConns 最大空闲链接数,默认与 MaxOpenConns 相同
+	MaxIdleConns int
+	// ConnMaxLifetime 链接最长使用时间,默认1小时
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime 链接最长空闲时间,默认不限制
+	ConnMaxIdleTime time.Duration
+	// ConnectRetries 链接失败后的重试次数
+	ConnectRetries int
+	// RetryBackoff 首次重试等待时间,之后每次翻倍,默认1s
+	RetryBackoff time.Duration
+	// TLSConfig 使用TLS链接,同一个配置只注册一次,注册后修改不生效
+	TLSConfig *tls.Config
+	// ReadyTimeout 启动时等待数据库可用的最长时间,超时后不再重试
+	ReadyTimeout time.Duration
+}
+
+// tlsNames 已注册的TLS配置,同一个配置只注册一次
+var (
+	tlsLock  sync.Mutex
+	tlsNames = map[*tls.Config]string{}
+)
+
+// registerTLS 注册TLS配置并返回名称
+func registerTLS(conf *tls.Config) (string, error) {
+	tlsLock.Lock()
+	defer tlsLock.Unlock()
+	name, ok := tlsNames[conf]
+	if ok {
+		return name, nil
+	}
+	name = "mdb_" + strconv.Itoa(len(tlsNames)+1)
+	err := mysql.RegisterTLSConfig(name, conf)
+	if err != nil {
+		return "", err
+	}
+	tlsNames[conf] = name
+	return name, nil
+}
+
 // Create 创建数据库链接
 func Create(dataSourceName string, showSQL bool) *sqlx.DB {
 	isShowSQL = showSQL
 
-	var err error
-	var db *sqlx.DB
-
-	db, err = sqlx.Connect("mysql", dataSourceName)
+	db, err := Open(context.Background(), dataSourceName, Options{})
 	if err != nil {
-		mlog.Log.Fatalf("db connect error: %s", err.Error())
+		mlog.Log.Fatalf("%s", err.Error())
 		return nil
 	}
+	return db
+}
 
-	count := runtime.NumCPU()*20 + 1
-	db.SetMaxOpenConns(count)
-	db.SetMaxIdleConns(count)
-	db.SetConnMaxLifetime(1 * time.Hour)
+// Open 创建数据库链接,失败时返回错误
+func Open(ctx context.Context, dataSourceName string, opts Options) (*sqlx.DB, error) {
+	db, err := openDB(dataSourceName, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	err = db.Ping()
+	if opts.ReadyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ReadyTimeout)
+		defer cancel()
+	}
+	err = mutils.Retry(ctx, opts.ConnectRetries, opts.RetryBackoff, func() error {
+		err := db.PingContext(ctx)
+		if err != nil {
+			mlog.Log.Warnf("db ping error: %s", err.Error())
+		}
+		return err
+	})
 	if err != nil {
-		mlog.Log.Fatalf("db ping error: %s", err.Error())
-		return nil
+		_ = db.Close()
+		return nil, fmt.Errorf("db ping error: %w", err)
 	}
-	return db
+	return db, nil
+}
+
+// openDB 创建数据库链接并设置链接池,不检查是否可用
+func openDB(dataSourceName string, opts Options) (*sqlx.DB, error) {
+	var err error
+	var db *sqlx.DB
+
+	if opts.TLSConfig != nil {
+		cfg, err := mysql.ParseDSN(dataSourceName)
+		if err != nil {
+			return nil, fmt.Errorf("db dsn error: %w", err)
+		}
+		tlsName, err := registerTLS(opts.TLSConfig)
+		if err != nil {
+			return nil, fmt.Errorf("db tls error: %w", err)
+		}
+		cfg.TLSConfig = tlsName
+		dataSourceName = cfg.FormatDSN()
+	}
+
+	db, err = sqlx.Open("mysql", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("db connect error: %w", err)
+	}
+
+	if opts.MaxOpenConns <= 0 {
+		opts.MaxOpenConns = runtime.NumCPU()*20 + 1
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = opts.MaxOpenConns
+	}
+	if opts.ConnMaxLifetime <= 0 {
+		opts.ConnMaxLifetime = 1 * time.Hour
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+	return db, nil
 }
 
 // SetShowSQL 设置是否显示sql
@@ -111,17 +294,22 @@ func SetShowSQL(b bool) {
 	isShowSQL = b
 }
 
+// ExecuteContent 执行sql语句并返回结果
+func ExecuteContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H) (sql.Result, error) {
+	query, args, err := wrapSQL(query, argMap, tx)
+	if err != nil {
+		return nil, err
+	}
+	return execIntercept(ctx, tx, query, args)
+}
+
 // ExecuteLastIDContent 执行sql语句并返回lastID
 func ExecuteLastIDContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H) (int64, error) {
 	query, args, err := wrapSQL(query, argMap, tx)
 	if err != nil {
 		return 0, err
 	}
-	ret, err := tx.ExecContext(
-		ctx,
-		query,
-		args...,
-	)
+	ret, err := execIntercept(ctx, tx, query, args)
 	if err != nil {
 		return 0, err
 	}
@@ -138,11 +326,7 @@ func ExecuteCountContent(ctx context.Context, tx ExecuteAble, query string, argM
 	if err != nil {
 		return 0, err
 	}
-	ret, err := tx.ExecContext(
-		ctx,
-		query,
-		args...,
-	)
+	ret, err := execIntercept(ctx, tx, query, args)
 	if err != nil {
 		return 0, err
 	}
@@ -165,11 +349,7 @@ func ExecuteCountManyContent(ctx context.Context, tx ExecuteAble, query string,
 	}
 	query = tx.Rebind(query)
 	sqlLog(query, args)
-	ret, err := tx.ExecContext(
-		ctx,
-		query,
-		args...,
-	)
+	ret, err := execIntercept(ctx, tx, query, args)
 	if err != nil {
 		return 0, err
 	}
@@ -186,12 +366,14 @@ func GetContent(ctx context.Context, tx ExecuteAble, dest interface{}, query str
 	if err != nil {
 		return false, err
 	}
-	err = tx.GetContext(
-		ctx,
-		dest,
-		query,
-		args...,
-	)
+	err = intercept(ctx, tx, OpGet, query, args, func(ctx context.Context) (int64, error) {
+		return -1, tx.GetContext(
+			ctx,
+			dest,
+			query,
+			args...,
+		)
+	})
 	if err == sql.ErrNoRows {
 		// 没有元素
 		return false, nil
@@ -209,12 +391,14 @@ func SelectContent(ctx context.Context, tx ExecuteAble, dest interface{}, query
 	if err != nil {
 		return err
 	}
-	err = tx.SelectContext(
-		ctx,
-		dest,
-		query,
-		args...,
-	)
+	err = intercept(ctx, tx, OpSelect, query, args, func(ctx context.Context) (int64, error) {
+		return -1, tx.SelectContext(
+			ctx,
+			dest,
+			query,
+			args...,
+		)
+	})
 	if err == sql.ErrNoRows {
 		// 没有元素
 		return nil
@@ -226,17 +410,28 @@ func SelectContent(ctx context.Context, tx ExecuteAble, dest interface{}, query
 	return nil
 }
 
-// RowsContent 执行sql查询并返回多行
+// RowsContent 执行sql查询并返回多行, DECIMAL 和 JSON 为字符串
 func RowsContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H) ([]gin.H, error) {
+	return rowsContent(ctx, tx, query, argMap, ScanRowsMap)
+}
+
+// RowsTypedContent 执行sql查询并返回多行, DECIMAL 为 Decimal, JSON 为解析后的值
+func RowsTypedContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H) ([]gin.H, error) {
+	return rowsContent(ctx, tx, query, argMap, ScanRowsMapTyped)
+}
+
+// rowsContent 执行sql查询并使用 scan 读取
+func rowsContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H, scan func(rows *sql.Rows) ([]gin.H, error)) ([]gin.H, error) {
 	query, args, err := wrapSQL(query, argMap, tx)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := tx.QueryContext(
-		ctx,
-		query,
-		args...,
-	)
+	var ret []gin.H
+	err = queryIntercept(ctx, tx, query, args, func(rows *sql.Rows) error {
+		var err error
+		ret, err = scan(rows)
+		return err
+	})
 	if err == sql.ErrNoRows {
 		// 没有元素
 		return nil, nil
@@ -244,79 +439,7 @@ func RowsContent(ctx context.Context, tx ExecuteAble, query string, argMap gin.H
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = rows.Close()
-	}()
-	cts, err := rows.ColumnTypes()
-	if err != nil {
-		return nil, err
-	}
-	l := len(cts)
-	columns := make([]reflect.Value, l)
-	columnsPoint := make([]interface{}, l)
-	for i, ct := range cts {
-		dbType := ct.DatabaseTypeName()
-		goType, ok := TypeMySQLToGoMap[dbType]
-		if !ok {
-			return nil, fmt.Errorf("no db type: %s", dbType)
-		}
-		var tv reflect.Value
-		switch goType {
-		case GoTypeString:
-			tv = reflect.New(reflect.TypeOf(""))
-		case GoTypeInt64:
-			tv = reflect.New(reflect.TypeOf(int64(0)))
-		case GoTypeBytes:
-			tv = reflect.New(reflect.TypeOf([]byte{}))
-		case GoTypeFloat64:
-			tv = reflect.New(reflect.TypeOf(float64(0)))
-		case GoTypeTime:
-			tv = reflect.New(reflect.TypeOf(time.Time{}))
-		default:
-			return nil, fmt.Errorf("no go type: %d", goType)
-		}
-		e := tv.Elem()
-		columns[i] = e
-		columnsPoint[i] = e.Addr().Interface()
-	}
-	var mapRows []gin.H
-	for rows.Next() {
-		err := rows.Scan(columnsPoint...)
-		if err != nil {
-			return nil, err
-		}
-		rowMap := gin.H{}
-		for i, v := range columns {
-			colName := cts[i].Name()
-			rowMap[colName] = v.Interface()
-		}
-		mapRows = append(mapRows, rowMap)
-	}
-	return mapRows, nil
-}
-
-// Transaction 执行事物
-func Transaction(ctx context.Context, db *sqlx.DB, f func(dbTx ExecuteAble) error) error {
-	isComment := false
-	tx, err := db.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if !isComment {
-			_ = tx.Rollback()
-		}
-	}()
-	err = f(tx)
-	if err != nil {
-		return err
-	}
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-	isComment = true
-	return nil
+	return ret, nil
 }
 
 // wrapSQL 打包sql
@@ -334,17 +457,12 @@ func wrapSQL(query string, argMap gin.H, tx ExecuteAble) (string, []interface{},
 	return query, args, nil
 }
 
+// sqlLog 开启 SetShowSQL 时输出每条执行的sql,参数脱敏
 func sqlLog(query string, args []interface{}) {
-	if isShowSQL {
-		queryStr := query + ";"
-		for _, arg := range args {
-			_, ok := arg.(string)
-			if ok {
-				queryStr = strings.Replace(queryStr, "?", fmt.Sprintf(`"%s"`, arg), 1)
-			} else {
-				queryStr = strings.Replace(queryStr, "?", fmt.Sprintf(`%v`, arg), 1)
-			}
-		}
-		mlog.Log.Debugf("exec sql:\n%s;\n%#v", query, args)
+	if !isShowSQL {
+		return
+	}
+	if ce := mlog.ZapLog.Check(zap.DebugLevel, "exec sql"); ce != nil {
+		ce.Write(SQLFields(query, args)...)
 	}
 }
@@ -0,0 +1,91 @@
+package mdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/moremorefun/mtool/mlog"
+)
+
+// 可重试的mysql错误码
+const (
+	MySQLErrLockWaitTimeout = 1205
+	MySQLErrDeadlock        = 1213
+)
+
+// RetryConfig 事务重试配置
+type RetryConfig struct {
+	// MaxAttempts 最多执行次数,默认3
+	MaxAttempts int
+	// BaseDelay 首次重试等待时间,默认50ms,之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 最长等待时间,默认1s
+	MaxDelay time.Duration
+	// TxOptions 事务选项
+	TxOptions *sql.TxOptions
+}
+
+// IsRetryableErr 是否是死锁或锁等待超时
+// 提交时的错误结果不确定,不可重试
+func IsRetryableErr(err error) bool {
+	var commitErr *CommitError
+	if errors.As(err, &commitErr) {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case MySQLErrDeadlock, MySQLErrLockWaitTimeout:
+		return true
+	}
+	return false
+}
+
+// TransactionRetry 执行事物,遇到死锁或锁等待超时时回滚并重新执行 f
+// db 已经是事务时不重试,由最外层事务负责
+func TransactionRetry(ctx context.Context, db ExecuteAble, conf RetryConfig, f func(dbTx ExecuteAble) error) error {
+	switch db.(type) {
+	case *Tx, *sqlx.Tx:
+		return TransactionOpts(ctx, db, conf.TxOptions, f)
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 3
+	}
+	if conf.BaseDelay <= 0 {
+		conf.BaseDelay = 50 * time.Millisecond
+	}
+	if conf.MaxDelay <= 0 {
+		conf.MaxDelay = time.Second
+	}
+	delay := conf.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := TransactionOpts(ctx, db, conf.TxOptions, f)
+		if err == nil {
+			return nil
+		}
+		if attempt >= conf.MaxAttempts || !IsRetryableErr(err) {
+			return err
+		}
+		// 随机等待 [delay/2, delay)
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		mlog.Log.Warnf("transaction retry attempt %d/%d after %s: %s", attempt+1, conf.MaxAttempts, wait, err.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+		if delay > conf.MaxDelay {
+			delay = conf.MaxDelay
+		}
+	}
+}
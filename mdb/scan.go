@@ -0,0 +1,646 @@
+package mdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// 字符串时间格式
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte{})
+)
+
+// structFieldsCache 结构体字段缓存
+var structFieldsCache sync.Map
+
+// RowScanner 行扫描器
+type RowScanner struct {
+	columns []string
+	goTypes []int64
+	values  []interface{}
+	points  []interface{}
+	// isTyped Map 返回 Decimal 和解析后的 json,默认两者都返回字符串
+	isTyped bool
+}
+
+// NewRowScanner 创建行扫描器
+func NewRowScanner(rows *sql.Rows) (*RowScanner, error) {
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	l := len(cts)
+	s := RowScanner{
+		columns: make([]string, l),
+		goTypes: make([]int64, l),
+		values:  make([]interface{}, l),
+		points:  make([]interface{}, l),
+	}
+	for i, ct := range cts {
+		dbType := ct.DatabaseTypeName()
+		goType, ok := GoTypeByDBType(dbType)
+		if !ok {
+			return nil, fmt.Errorf("no db type: %s", dbType)
+		}
+		s.columns[i] = ct.Name()
+		s.goTypes[i] = goType
+		s.points[i] = &s.values[i]
+	}
+	return &s, nil
+}
+
+// Typed Map 中 DECIMAL 返回 Decimal, JSON 返回解析后的 map 或 slice
+func (s *RowScanner) Typed() *RowScanner {
+	s.isTyped = true
+	return s
+}
+
+// Columns 字段名
+func (s *RowScanner) Columns() []string {
+	return s.columns
+}
+
+// Scan 读取当前行
+func (s *RowScanner) Scan(rows *sql.Rows) error {
+	return rows.Scan(s.points...)
+}
+
+// Map 当前行转换为map
+func (s *RowScanner) Map() (gin.H, error) {
+	row := gin.H{}
+	for i, col := range s.columns {
+		goType := s.goTypes[i]
+		if !s.isTyped && (goType == GoTypeDecimal || goType == GoTypeJSON) {
+			goType = GoTypeString
+		}
+		v, err := ConvertValue(goType, s.values[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", col, err)
+		}
+		row[col] = v
+	}
+	return row, nil
+}
+
+// Struct 当前行写入结构体
+func (s *RowScanner) Struct(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("scan dest must be a non-nil pointer: %T", dest)
+	}
+	return s.structValue(reflect.Indirect(rv))
+}
+
+// structValue 当前行写入结构体
+func (s *RowScanner) structValue(sv reflect.Value) error {
+	for sv.Kind() == reflect.Ptr {
+		if sv.IsNil() {
+			sv.Set(reflect.New(sv.Type().Elem()))
+		}
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Struct {
+		return fmt.Errorf("scan dest must be a struct: %s", sv.Type())
+	}
+	fields := getStructFields(sv.Type())
+	for i, col := range s.columns {
+		index, ok := fields[col]
+		if !ok {
+			return fmt.Errorf("no field for column: %s", col)
+		}
+		fv := FieldByIndexAlloc(sv, index)
+		err := setValue(fv, s.goTypes[i], s.values[i])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+	}
+	return nil
+}
+
+// ScanRowsMap 读取所有行到map, DECIMAL 和 JSON 为字符串
+func ScanRowsMap(rows *sql.Rows) ([]gin.H, error) {
+	s, err := NewRowScanner(rows)
+	if err != nil {
+		return nil, err
+	}
+	return scanRowsMap(rows, s)
+}
+
+// ScanRowsMapTyped 读取所有行到map, DECIMAL 为 Decimal, JSON 为解析后的值
+func ScanRowsMapTyped(rows *sql.Rows) ([]gin.H, error) {
+	s, err := NewRowScanner(rows)
+	if err != nil {
+		return nil, err
+	}
+	return scanRowsMap(rows, s.Typed())
+}
+
+// scanRowsMap 使用扫描器读取所有行
+func scanRowsMap(rows *sql.Rows, s *RowScanner) ([]gin.H, error) {
+	var err error
+	var mapRows []gin.H
+	for rows.Next() {
+		err = s.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		row, err := s.Map()
+		if err != nil {
+			return nil, err
+		}
+		mapRows = append(mapRows, row)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return mapRows, nil
+}
+
+// ScanRows 读取所有行到结构体
+// dest 为 *[]T, *[]*T 或 *T, *T 时只读取第一行并返回是否有数据
+func ScanRows(rows *sql.Rows, dest interface{}) (bool, error) {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return false, fmt.Errorf("scan dest must be a non-nil pointer: %T", dest)
+	}
+	s, err := NewRowScanner(rows)
+	if err != nil {
+		return false, err
+	}
+	dv := rv.Elem()
+	if dv.Kind() != reflect.Slice {
+		if !rows.Next() {
+			return false, rows.Err()
+		}
+		err = s.Scan(rows)
+		if err != nil {
+			return false, err
+		}
+		err = s.structValue(dv)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	elemType := dv.Type().Elem()
+	has := false
+	for rows.Next() {
+		err = s.Scan(rows)
+		if err != nil {
+			return false, err
+		}
+		ev := reflect.New(elemType).Elem()
+		err = s.structValue(ev)
+		if err != nil {
+			return false, err
+		}
+		dv.Set(reflect.Append(dv, ev))
+		has = true
+	}
+	err = rows.Err()
+	if err != nil {
+		return false, err
+	}
+	return has, nil
+}
+
+// ScanContent 执行sql查询并按db标签写入结构体
+func ScanContent(ctx context.Context, tx ExecuteAble, dest interface{}, query string, argMap gin.H) (bool, error) {
+	query, args, err := wrapSQL(query, argMap, tx)
+	if err != nil {
+		return false, err
+	}
+	var has bool
+	err = queryIntercept(ctx, tx, query, args, func(rows *sql.Rows) error {
+		var err error
+		has, err = ScanRows(rows, dest)
+		return err
+	})
+	if err == sql.ErrNoRows {
+		// 没有元素
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return has, nil
+}
+
+// MapToStruct 把 ScanRowsMap 得到的行按db标签写入结构体,结构体中没有的列忽略
+func MapToStruct(row gin.H, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("scan dest must be a non-nil pointer: %T", dest)
+	}
+	sv := rv.Elem()
+	if sv.Kind() != reflect.Struct {
+		return fmt.Errorf("scan dest must be a struct: %s", sv.Type())
+	}
+	for _, field := range GetStructFields(sv.Type()) {
+		v, ok := row[field.Name]
+		if !ok {
+			continue
+		}
+		fv := FieldByIndexAlloc(sv, field.Index)
+		err := setMapValue(fv, v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+// setMapValue 写入已转换的值
+func setMapValue(fv reflect.Value, v interface{}) error {
+	if v != nil {
+		vv := reflect.ValueOf(v)
+		if vv.Type().AssignableTo(fv.Type()) {
+			fv.Set(vv)
+			return nil
+		}
+		switch vv.Kind() {
+		case reflect.Map, reflect.Slice:
+			if vv.Type() != bytesType {
+				// json 列
+				b, err := jsoniter.Marshal(v)
+				if err != nil {
+					return err
+				}
+				switch {
+				case fv.Kind() == reflect.String:
+					fv.SetString(string(b))
+					return nil
+				case fv.Type() == bytesType:
+					fv.SetBytes(b)
+					return nil
+				}
+				return setValue(fv, GoTypeJSON, b)
+			}
+		}
+	}
+	if _, ok := v.(string); ok && isJSONKind(fv.Type()) {
+		// 未解析的 json 列
+		return setValue(fv, GoTypeJSON, v)
+	}
+	return setValue(fv, GoTypeAny, v)
+}
+
+// isJSONKind 字段是否需要从 json 解析
+func isJSONKind(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(scannerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Slice:
+		return t != bytesType
+	case reflect.Struct:
+		return t != timeType
+	}
+	return false
+}
+
+// ConvertValue 将驱动返回的值转换为对应go类型
+func ConvertValue(goType int64, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch goType {
+	case GoTypeString:
+		return toString(v), nil
+	case GoTypeInt64:
+		return toInt64(v)
+	case GoTypeUint64:
+		return toUint64(v)
+	case GoTypeBytes:
+		b, ok := v.([]byte)
+		if !ok {
+			return []byte(toString(v)), nil
+		}
+		return b, nil
+	case GoTypeFloat64:
+		return toFloat64(v)
+	case GoTypeTime:
+		return toTime(v)
+	case GoTypeDecimal:
+		var d Decimal
+		err := d.Scan(v)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	case GoTypeBool:
+		return toBool(v)
+	case GoTypeAny:
+		b, ok := v.([]byte)
+		if ok {
+			return string(b), nil
+		}
+		return v, nil
+	case GoTypeJSON:
+		var j interface{}
+		err := jsoniter.Unmarshal([]byte(toString(v)), &j)
+		if err != nil {
+			return nil, err
+		}
+		return j, nil
+	}
+	return nil, fmt.Errorf("no go type: %d", goType)
+}
+
+// setValue 写入字段
+func setValue(fv reflect.Value, goType int64, v interface{}) error {
+	if fv.Kind() == reflect.Ptr {
+		if v == nil {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setValue(fv.Elem(), goType, v)
+	}
+	if fv.Addr().Type().Implements(scannerType) {
+		// sql.Null* Decimal 等自行处理
+		return fv.Addr().Interface().(sql.Scanner).Scan(v)
+	}
+	if v == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	if goType == GoTypeJSON && fv.Kind() != reflect.String && fv.Type() != bytesType {
+		return jsoniter.Unmarshal([]byte(toString(v)), fv.Addr().Interface())
+	}
+	cv, err := ConvertValue(goType, v)
+	if err != nil {
+		return err
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(toString(cv))
+		return nil
+	case reflect.Bool:
+		b, err := toBool(cv)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt64(cv)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(i) {
+			return fmt.Errorf("value %d overflows %s", i, fv.Type())
+		}
+		fv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := toUint64(cv)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(u) {
+			return fmt.Errorf("value %d overflows %s", u, fv.Type())
+		}
+		fv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(cv)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		fv.Set(reflect.ValueOf(cv))
+		return nil
+	}
+	switch fv.Type() {
+	case bytesType:
+		fv.SetBytes([]byte(toString(cv)))
+		return nil
+	case timeType:
+		t, err := toTime(cv)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	return fmt.Errorf("unsupported field type: %s", fv.Type())
+}
+
+// StructField 结构体中对应数据库列的字段
+type StructField struct {
+	// Name 列名,db标签或小写的字段名
+	Name string
+	// Index 字段索引,可用于 FieldByIndex
+	Index []int
+	// Options db标签中逗号后的选项,如 omitempty
+	Options []string
+}
+
+// HasOption 是否有标签选项
+func (f StructField) HasOption(option string) bool {
+	for _, o := range f.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// structFields 结构体字段
+type structFields struct {
+	list  []StructField
+	index map[string][]int
+}
+
+// GetStructFields 获取结构体的数据库字段,匿名结构体展开,同名时先出现的优先
+func GetStructFields(t reflect.Type) []StructField {
+	return loadStructFields(t).list
+}
+
+// getStructFields 获取字段名到字段索引
+func getStructFields(t reflect.Type) map[string][]int {
+	return loadStructFields(t).index
+}
+
+// loadStructFields 获取字段并缓存
+func loadStructFields(t reflect.Type) *structFields {
+	cached, ok := structFieldsCache.Load(t)
+	if ok {
+		return cached.(*structFields)
+	}
+	fields := &structFields{
+		index: map[string][]int{},
+	}
+	walkStructFields(t, nil, fields)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+// walkStructFields 遍历字段,匿名结构体展开
+func walkStructFields(t reflect.Type, parent []int, fields *structFields) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		tag := f.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		tagParts := strings.Split(tag, ",")
+		name := tagParts[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct && ft != timeType {
+			walkStructFields(ft, index, fields)
+			continue
+		}
+		if len(f.PkgPath) != 0 {
+			// 未导出
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(f.Name)
+		}
+		if _, ok := fields.index[name]; !ok {
+			fields.index[name] = index
+			fields.list = append(fields.list, StructField{
+				Name:    name,
+				Index:   index,
+				Options: tagParts[1:],
+			})
+		}
+	}
+}
+
+// FieldByIndexAlloc 获取字段,中间的空指针自动创建
+func FieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func toString(v interface{}) string {
+	switch tv := v.(type) {
+	case []byte:
+		return string(tv)
+	case string:
+		return tv
+	case time.Time:
+		return tv.Format(timeLayouts[0])
+	}
+	return fmt.Sprint(v)
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch tv := v.(type) {
+	case int64:
+		return tv, nil
+	case uint64:
+		if tv > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", tv)
+		}
+		return int64(tv), nil
+	case float64:
+		return int64(tv), nil
+	case bool:
+		if tv {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return strconv.ParseInt(toString(v), 10, 64)
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch tv := v.(type) {
+	case bool:
+		return tv, nil
+	case int64:
+		return tv != 0, nil
+	case uint64:
+		return tv != 0, nil
+	}
+	return strconv.ParseBool(toString(v))
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	switch tv := v.(type) {
+	case uint64:
+		return tv, nil
+	case int64:
+		if tv < 0 {
+			return 0, fmt.Errorf("value %d is negative", tv)
+		}
+		return uint64(tv), nil
+	}
+	return strconv.ParseUint(toString(v), 10, 64)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch tv := v.(type) {
+	case float64:
+		return tv, nil
+	case float32:
+		return float64(tv), nil
+	case int64:
+		return float64(tv), nil
+	case uint64:
+		return float64(tv), nil
+	case Decimal:
+		return tv.Float64(), nil
+	}
+	return strconv.ParseFloat(toString(v), 64)
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	t, ok := v.(time.Time)
+	if ok {
+		return t, nil
+	}
+	s := toString(v)
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("time parse error: %s", s)
+}
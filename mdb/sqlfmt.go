@@ -0,0 +1,402 @@
+package mdb
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SensitiveMask 敏感值的替换内容
+const SensitiveMask = "'******'"
+
+// DefaultSensitiveColumns 默认敏感列,列名相等或以 _列名 结尾时脱敏
+var DefaultSensitiveColumns = []string{
+	"password",
+	"passwd",
+	"pwd",
+	"secret",
+	"token",
+	"phone",
+	"mobile",
+}
+
+var (
+	sensitiveMutex   sync.RWMutex
+	sensitiveColumns = DefaultSensitiveColumns
+)
+
+// SetSensitiveColumns 设置敏感列,覆盖默认值
+func SetSensitiveColumns(columns ...string) {
+	cols := make([]string, len(columns))
+	for i, col := range columns {
+		cols[i] = strings.ToLower(col)
+	}
+	sensitiveMutex.Lock()
+	sensitiveColumns = cols
+	sensitiveMutex.Unlock()
+}
+
+// AddSensitiveColumns 添加敏感列
+func AddSensitiveColumns(columns ...string) {
+	sensitiveMutex.Lock()
+	defer sensitiveMutex.Unlock()
+	cols := make([]string, 0, len(sensitiveColumns)+len(columns))
+	cols = append(cols, sensitiveColumns...)
+	for _, col := range columns {
+		cols = append(cols, strings.ToLower(col))
+	}
+	sensitiveColumns = cols
+}
+
+// isSensitiveColumn 是否敏感列
+func isSensitiveColumn(column string) bool {
+	if len(column) == 0 {
+		return false
+	}
+	column = strings.ToLower(strings.ReplaceAll(column, "`", ""))
+	index := strings.LastIndex(column, ".")
+	if index >= 0 {
+		column = column[index+1:]
+	}
+	sensitiveMutex.RLock()
+	defer sensitiveMutex.RUnlock()
+	for _, col := range sensitiveColumns {
+		if column == col || strings.HasSuffix(column, "_"+col) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sensitive 敏感参数,执行时使用原值,日志中脱敏
+// 参数中有切片时 sqlx.In 会展开为原值,此时只能通过列名脱敏
+type Sensitive struct {
+	V interface{}
+}
+
+// Value 原值
+func (s Sensitive) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(s.V)
+}
+
+// SQLLiteral 按 mysql 格式生成字面量
+func SQLLiteral(v interface{}) string {
+	switch tv := v.(type) {
+	case nil:
+		return "NULL"
+	case Sensitive:
+		return SensitiveMask
+	case string:
+		return quoteString(tv)
+	case []byte:
+		if tv == nil {
+			return "NULL"
+		}
+		return "X'" + hex.EncodeToString(tv) + "'"
+	case time.Time:
+		if tv.IsZero() {
+			return "'0000-00-00 00:00:00'"
+		}
+		return "'" + tv.Format("2006-01-02 15:04:05.999999") + "'"
+	case *time.Time:
+		if tv == nil {
+			return "NULL"
+		}
+		return SQLLiteral(*tv)
+	case bool:
+		if tv {
+			return "1"
+		}
+		return "0"
+	case int:
+		return strconv.FormatInt(int64(tv), 10)
+	case int8:
+		return strconv.FormatInt(int64(tv), 10)
+	case int16:
+		return strconv.FormatInt(int64(tv), 10)
+	case int32:
+		return strconv.FormatInt(int64(tv), 10)
+	case int64:
+		return strconv.FormatInt(tv, 10)
+	case uint:
+		return strconv.FormatUint(uint64(tv), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(tv), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(tv), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(tv), 10)
+	case uint64:
+		return strconv.FormatUint(tv, 10)
+	case float32:
+		return strconv.FormatFloat(float64(tv), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(tv, 'g', -1, 64)
+	case driver.Valuer:
+		dv, err := tv.Value()
+		if err != nil {
+			return quoteString(fmt.Sprintf("!%s", err.Error()))
+		}
+		return SQLLiteral(dv)
+	}
+	return quoteString(fmt.Sprint(v))
+}
+
+// quoteString mysql 字符串转义
+func quoteString(s string) string {
+	var buf strings.Builder
+	buf.Grow(len(s) + 2)
+	buf.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\x1a':
+			buf.WriteString(`\Z`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// sqlFormatKeywords 占位符前不作为列名的关键字
+var sqlFormatKeywords = map[string]bool{
+	"AND":     true,
+	"OR":      true,
+	"NOT":     true,
+	"IN":      true,
+	"IS":      true,
+	"LIKE":    true,
+	"BETWEEN": true,
+	"REGEXP":  true,
+	"ESCAPE":  true,
+	"NULL":    true,
+}
+
+// isIdentByte 是否标识符字符
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c == '`' || c == '$' ||
+		(c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c >= 0x80
+}
+
+// FormatSQL 把参数填入占位符,生成可以直接执行的sql,用于日志
+// 字符串和注释中的 ? 不处理,敏感列和 Sensitive 参数脱敏
+// 敏感列通过占位符前的列名和 INSERT 的列列表判断
+func FormatSQL(query string, args []interface{}) string {
+	var buf strings.Builder
+	buf.Grow(len(query) + len(args)*8)
+
+	argIndex := 0
+	lastIdent := ""
+	isFirstWord := true
+	isInsert := false
+	isValues := false
+	isCapture := false
+	var insertColumns []string
+	depth := 0
+	tuplePos := 0
+
+	writeArg := func(index int, column string) {
+		literal := SensitiveMask
+		if !isSensitiveColumn(column) {
+			literal = SQLLiteral(args[index])
+		}
+		buf.WriteString(literal)
+	}
+	placeholderColumn := func() string {
+		if isValues && depth >= 1 && tuplePos < len(insertColumns) {
+			return insertColumns[tuplePos]
+		}
+		return lastIdent
+	}
+
+	l := len(query)
+	for i := 0; i < l; i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 字符串
+			j := i + 1
+			for j < l {
+				if query[j] == '\\' {
+					j += 2
+					continue
+				}
+				if query[j] == c {
+					if j+1 < l && query[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= l {
+				j = l - 1
+			}
+			buf.WriteString(query[i : j+1])
+			i = j
+		case c == '#' || (c == '-' && i+1 < l && query[i+1] == '-'):
+			// 单行注释
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = l - i - 1
+			}
+			buf.WriteString(query[i : i+j+1])
+			i += j
+		case c == '/' && i+1 < l && query[i+1] == '*':
+			// 多行注释
+			j := strings.Index(query[i+2:], "*/")
+			end := l - 1
+			if j >= 0 {
+				end = i + 2 + j + 1
+			}
+			buf.WriteString(query[i : end+1])
+			i = end
+		case c == '?':
+			if argIndex < len(args) {
+				writeArg(argIndex, placeholderColumn())
+			} else {
+				buf.WriteByte(c)
+			}
+			argIndex++
+		case c == '$' && i+1 < l && query[i+1] >= '0' && query[i+1] <= '9':
+			// postgres 占位符
+			j := i + 1
+			for j < l && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			if n >= 1 && n <= len(args) {
+				writeArg(n-1, placeholderColumn())
+			} else {
+				buf.WriteString(query[i:j])
+			}
+			i = j - 1
+		case isIdentByte(c) && c != '$':
+			j := i
+			for j < l && isIdentByte(query[j]) {
+				j++
+			}
+			word := query[i:j]
+			buf.WriteString(word)
+			i = j - 1
+			upper := strings.ToUpper(word)
+			if isFirstWord {
+				isFirstWord = false
+				isInsert = upper == "INSERT" || upper == "REPLACE"
+			}
+			if isInsert && depth == 0 {
+				if upper == "VALUES" || upper == "VALUE" {
+					isValues = true
+					continue
+				}
+				if isValues {
+					isValues = false
+				}
+			}
+			if isCapture {
+				insertColumns = append(insertColumns, strings.ReplaceAll(word, "`", ""))
+				continue
+			}
+			if sqlFormatKeywords[upper] || (c >= '0' && c <= '9') {
+				continue
+			}
+			k := j
+			for k < l && (query[k] == ' ' || query[k] == '\t' || query[k] == '\n') {
+				k++
+			}
+			if k < l && query[k] == '(' {
+				// 函数
+				continue
+			}
+			lastIdent = word
+		case c == '(':
+			buf.WriteByte(c)
+			depth++
+			if isInsert && !isValues && depth == 1 && insertColumns == nil {
+				isCapture = true
+			}
+			if isValues && depth == 1 {
+				tuplePos = 0
+			}
+		case c == ')':
+			buf.WriteByte(c)
+			depth--
+			if isCapture && depth == 0 {
+				isCapture = false
+			}
+		case c == ',':
+			buf.WriteByte(c)
+			if isValues && depth == 1 {
+				tuplePos++
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// SQLFields 生成日志字段, sql 为填入脱敏参数并压缩为一行的语句
+func SQLFields(query string, args []interface{}) []zap.Field {
+	return []zap.Field{
+		zap.String("sql", compactSQL(FormatSQL(query, args))),
+	}
+}
+
+// compactSQL 把字符串外的连续空白压缩为一个空格
+func compactSQL(query string) string {
+	var buf strings.Builder
+	buf.Grow(len(query))
+	var quote byte
+	isSpace := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(query) {
+				i++
+				buf.WriteByte(query[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			isSpace = true
+			continue
+		case '\'', '"', '`':
+			quote = c
+		}
+		if isSpace && buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		isSpace = false
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
@@ -0,0 +1,111 @@
+package mdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{
+			name:  "literals",
+			query: "SELECT * FROM t WHERE a=? AND b=? AND c=? AND d=? AND e=?",
+			args:  []interface{}{1, "x'y", nil, true, 1.5},
+			want:  `SELECT * FROM t WHERE a=1 AND b='x\'y' AND c=NULL AND d=1 AND e=1.5`,
+		},
+		{
+			name:  "time and bytes",
+			query: "UPDATE t SET at=?, raw=?",
+			args:  []interface{}{time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC), []byte{0xab}},
+			want:  "UPDATE t SET at='2021-01-02 03:04:05', raw=X'ab'",
+		},
+		{
+			name:  "placeholder in string and comment",
+			query: "SELECT '?' /* ? */ FROM t WHERE a=? -- ?\n",
+			args:  []interface{}{2},
+			want:  "SELECT '?' /* ? */ FROM t WHERE a=2 -- ?\n",
+		},
+		{
+			name:  "sensitive column",
+			query: "SELECT id FROM user WHERE name=? AND `u`.`password`=? AND user_token IN (?, ?)",
+			args:  []interface{}{"a", "p", "t1", "t2"},
+			want:  "SELECT id FROM user WHERE name='a' AND `u`.`password`='******' AND user_token IN ('******', '******')",
+		},
+		{
+			name:  "sensitive value",
+			query: "UPDATE user SET name=? WHERE id=?",
+			args:  []interface{}{Sensitive{V: "a"}, 1},
+			want:  "UPDATE user SET name='******' WHERE id=1",
+		},
+		{
+			name:  "insert columns",
+			query: "INSERT INTO user (`name`, `phone`, created) VALUES (?, ?, NOW()), (?, ?, NOW())",
+			args:  []interface{}{"a", "1", "b", "2"},
+			want:  "INSERT INTO user (`name`, `phone`, created) VALUES ('a', '******', NOW()), ('b', '******', NOW())",
+		},
+		{
+			name:  "function argument",
+			query: "SELECT * FROM t WHERE secret=MD5(?)",
+			args:  []interface{}{"s"},
+			want:  "SELECT * FROM t WHERE secret=MD5('******')",
+		},
+		{
+			name:  "postgres placeholder",
+			query: "SELECT * FROM t WHERE a=$2 AND pwd=$1 AND b=$3",
+			args:  []interface{}{"p", 7},
+			want:  "SELECT * FROM t WHERE a=7 AND pwd='******' AND b=$3",
+		},
+		{
+			name:  "missing args",
+			query: "SELECT * FROM t WHERE a=? AND b=?",
+			args:  []interface{}{1},
+			want:  "SELECT * FROM t WHERE a=1 AND b=?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatSQL(tt.query, tt.args)
+			if got != tt.want {
+				t.Errorf("FormatSQL:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{
+			name:  "compact",
+			query: "SELECT\n    id\nFROM\n    t\nWHERE\n    name=?",
+			args:  []interface{}{"a  b"},
+			want:  "SELECT id FROM t WHERE name='a  b'",
+		},
+		{
+			name:  "keep quoted space",
+			query: "SELECT `a   b`,  ' x '\tFROM t WHERE mobile=?",
+			args:  []interface{}{"138"},
+			want:  "SELECT `a   b`, ' x ' FROM t WHERE mobile='******'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := SQLFields(tt.query, tt.args)
+			if len(fields) != 1 || fields[0].Key != "sql" {
+				t.Fatalf("SQLFields fields: %v", fields)
+			}
+			if fields[0].String != tt.want {
+				t.Errorf("SQLFields sql:\n%s\nwant:\n%s", fields[0].String, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package mdb
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultStmtCacheSize 默认缓存语句个数
+const DefaultStmtCacheSize = 256
+
+// StmtCacheStats 语句缓存统计
+type StmtCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Size      int64
+}
+
+// stmtEntry 缓存的语句
+type stmtEntry struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int64
+	evicted bool
+}
+
+// StmtDB 带预处理语句缓存的数据库,实现 ExecuteAble
+// 以生成的sql为key,缓存最近使用的 capacity 个预处理语句
+type StmtDB struct {
+	*sqlx.DB
+
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	entries  map[string]*list.Element
+	stats    StmtCacheStats
+}
+
+// NewStmtDB 创建带语句缓存的数据库, capacity<=0 时使用默认值
+func NewStmtDB(db *sqlx.DB, capacity int) *StmtDB {
+	if capacity <= 0 {
+		capacity = DefaultStmtCacheSize
+	}
+	return &StmtDB{
+		DB:       db,
+		capacity: capacity,
+		ll:       list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+// CacheStats 获取缓存统计
+func (db *StmtDB) CacheStats() StmtCacheStats {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	stats := db.stats
+	stats.Size = int64(db.ll.Len())
+	return stats
+}
+
+// Close 关闭所有缓存语句和数据库
+func (db *StmtDB) Close() error {
+	db.mu.Lock()
+	var stmts []*sqlx.Stmt
+	for _, el := range db.entries {
+		e := el.Value.(*stmtEntry)
+		e.evicted = true
+		if e.refs == 0 {
+			stmts = append(stmts, e.stmt)
+		}
+	}
+	db.entries = map[string]*list.Element{}
+	db.ll.Init()
+	db.mu.Unlock()
+	for _, stmt := range stmts {
+		_ = stmt.Close()
+	}
+	return db.DB.Close()
+}
+
+// acquire 获取语句,使用完成后需要调用 release
+func (db *StmtDB) acquire(ctx context.Context, query string) (*stmtEntry, error) {
+	db.mu.Lock()
+	el, ok := db.entries[query]
+	if ok {
+		e := el.Value.(*stmtEntry)
+		db.ll.MoveToFront(el)
+		e.refs++
+		db.stats.Hits++
+		db.mu.Unlock()
+		return e, nil
+	}
+	db.stats.Misses++
+	db.mu.Unlock()
+
+	stmt, err := db.DB.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	el, ok = db.entries[query]
+	if ok {
+		// 并发预处理了同一语句,使用已缓存的
+		e := el.Value.(*stmtEntry)
+		db.ll.MoveToFront(el)
+		e.refs++
+		db.mu.Unlock()
+		_ = stmt.Close()
+		return e, nil
+	}
+	e := &stmtEntry{
+		query: query,
+		stmt:  stmt,
+		refs:  1,
+	}
+	db.entries[query] = db.ll.PushFront(e)
+	var closeStmts []*sqlx.Stmt
+	for db.ll.Len() > db.capacity {
+		old := db.ll.Back()
+		oldEntry := db.removeLocked(old)
+		db.stats.Evictions++
+		if oldEntry.refs == 0 {
+			closeStmts = append(closeStmts, oldEntry.stmt)
+		}
+	}
+	db.mu.Unlock()
+	for _, closeStmt := range closeStmts {
+		_ = closeStmt.Close()
+	}
+	return e, nil
+}
+
+// release 释放语句
+func (db *StmtDB) release(e *stmtEntry) {
+	db.mu.Lock()
+	e.refs--
+	isClose := e.evicted && e.refs == 0
+	db.mu.Unlock()
+	if isClose {
+		_ = e.stmt.Close()
+	}
+}
+
+// evict 移除语句,下次使用时重新预处理
+func (db *StmtDB) evict(e *stmtEntry) {
+	db.mu.Lock()
+	el, ok := db.entries[e.query]
+	if ok && el.Value.(*stmtEntry) == e {
+		db.removeLocked(el)
+		db.stats.Evictions++
+	}
+	db.mu.Unlock()
+}
+
+// removeLocked 从缓存中移除,需要持有锁
+func (db *StmtDB) removeLocked(el *list.Element) *stmtEntry {
+	e := el.Value.(*stmtEntry)
+	db.ll.Remove(el)
+	delete(db.entries, e.query)
+	e.evicted = true
+	return e
+}
+
+// run 使用缓存语句执行
+// 语句已关闭时重新预处理后重试一次,连接断开时移除语句
+func (db *StmtDB) run(ctx context.Context, query string, f func(stmt *sqlx.Stmt) error) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		var e *stmtEntry
+		e, err = db.acquire(ctx, query)
+		if err != nil {
+			return err
+		}
+		err = f(e.stmt)
+		db.release(e)
+		if err == nil {
+			return nil
+		}
+		if isStmtClosedErr(err) {
+			db.evict(e)
+			continue
+		}
+		if isConnLostErr(err) {
+			db.evict(e)
+		}
+		return err
+	}
+	return err
+}
+
+// Exec 执行
+func (db *StmtDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// Get 获取单行
+func (db *StmtDB) Get(dest interface{}, query string, args ...interface{}) error {
+	return db.GetContext(context.Background(), dest, query, args...)
+}
+
+// Select 获取多行
+func (db *StmtDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return db.SelectContext(context.Background(), dest, query, args...)
+}
+
+// ExecContext 执行
+func (db *StmtDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var ret sql.Result
+	err := db.run(ctx, query, func(stmt *sqlx.Stmt) error {
+		var err error
+		ret, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	return ret, err
+}
+
+// GetContext 获取单行
+func (db *StmtDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.run(ctx, query, func(stmt *sqlx.Stmt) error {
+		return stmt.GetContext(ctx, dest, args...)
+	})
+}
+
+// SelectContext 获取多行
+func (db *StmtDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.run(ctx, query, func(stmt *sqlx.Stmt) error {
+		return stmt.SelectContext(ctx, dest, args...)
+	})
+}
+
+// QueryContext 查询
+func (db *StmtDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := db.run(ctx, query, func(stmt *sqlx.Stmt) error {
+		var err error
+		rows, err = stmt.QueryContext(ctx, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowContext 查询单行
+func (db *StmtDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	e, err := db.acquire(ctx, query)
+	if err != nil {
+		// 通过原始连接返回带错误的 Row
+		return db.DB.QueryRowContext(ctx, query, args...)
+	}
+	defer db.release(e)
+	return e.stmt.QueryRowContext(ctx, args...)
+}
+
+// StmtTx 使用缓存语句的事务,语句绑定到事务连接
+type StmtTx struct {
+	*sqlx.Tx
+	db *StmtDB
+}
+
+// runTx 在事务中使用缓存语句执行
+func (tx *StmtTx) runTx(ctx context.Context, query string, f func(stmt *sqlx.Stmt) error) error {
+	return tx.db.run(ctx, query, func(stmt *sqlx.Stmt) error {
+		return f(tx.Tx.StmtxContext(ctx, stmt))
+	})
+}
+
+// Exec 执行
+func (tx *StmtTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+// Get 获取单行
+func (tx *StmtTx) Get(dest interface{}, query string, args ...interface{}) error {
+	return tx.GetContext(context.Background(), dest, query, args...)
+}
+
+// Select 获取多行
+func (tx *StmtTx) Select(dest interface{}, query string, args ...interface{}) error {
+	return tx.SelectContext(context.Background(), dest, query, args...)
+}
+
+// ExecContext 执行
+func (tx *StmtTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var ret sql.Result
+	err := tx.runTx(ctx, query, func(stmt *sqlx.Stmt) error {
+		var err error
+		ret, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	return ret, err
+}
+
+// GetContext 获取单行
+func (tx *StmtTx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.runTx(ctx, query, func(stmt *sqlx.Stmt) error {
+		return stmt.GetContext(ctx, dest, args...)
+	})
+}
+
+// SelectContext 获取多行
+func (tx *StmtTx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return tx.runTx(ctx, query, func(stmt *sqlx.Stmt) error {
+		return stmt.SelectContext(ctx, dest, args...)
+	})
+}
+
+// QueryContext 查询
+func (tx *StmtTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := tx.runTx(ctx, query, func(stmt *sqlx.Stmt) error {
+		var err error
+		rows, err = stmt.QueryContext(ctx, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRowContext 查询单行
+func (tx *StmtTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	e, err := tx.db.acquire(ctx, query)
+	if err != nil {
+		return tx.Tx.QueryRowContext(ctx, query, args...)
+	}
+	defer tx.db.release(e)
+	return tx.Tx.StmtxContext(ctx, e.stmt).QueryRowContext(ctx, args...)
+}
+
+// beginTx 开始事务,事务内使用缓存语句
+func (db *StmtDB) beginTx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, ExecuteAble, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, &StmtTx{
+		Tx: tx,
+		db: db,
+	}, nil
+}
+
+// Transaction 执行事物,事务内使用缓存语句
+func (db *StmtDB) Transaction(ctx context.Context, f func(dbTx ExecuteAble) error) error {
+	return Transaction(ctx, db, f)
+}
+
+// isStmtClosedErr 语句已被关闭
+func isStmtClosedErr(err error) bool {
+	return strings.Contains(err.Error(), "statement is closed")
+}
+
+// isConnLostErr 连接已断开
+func isConnLostErr(err error) bool {
+	return errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone)
+}
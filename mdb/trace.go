@@ -0,0 +1,127 @@
+package mdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Span 调用跨度,通过 context.Context 传递
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	StartTime    time.Time
+	EndTime      time.Time
+	Err          error
+
+	mutex      sync.Mutex
+	attributes map[string]interface{}
+}
+
+// spanCtxKey 跨度标记
+type spanCtxKey struct{}
+
+// ContextWithSpan 把跨度放入 ctx
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanCtxKey{}, span)
+}
+
+// SpanFromContext 获取 ctx 中的跨度,没有时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanCtxKey{}).(*Span)
+	return span
+}
+
+// StartSpan 开始跨度, ctx 中有跨度时作为子跨度
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{
+		SpanID:    randomHex(8),
+		Name:      name,
+		StartTime: time.Now(),
+	}
+	parent := SpanFromContext(ctx)
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(k string, v interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.attributes == nil {
+		s.attributes = map[string]interface{}{}
+	}
+	s.attributes[k] = v
+}
+
+// Attributes 获取属性
+func (s *Span) Attributes() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+	return attributes
+}
+
+// End 结束跨度
+func (s *Span) End() {
+	s.EndTime = time.Now()
+}
+
+// Duration 耗时
+func (s *Span) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// SpanInterceptor 跨度拦截器,每次执行创建子跨度,结束后调用 export
+func SpanInterceptor(export func(span *Span)) Interceptor {
+	return func(ctx context.Context, info *QueryInfo, next func(ctx context.Context) error) error {
+		ctx, span := StartSpan(ctx, "mdb."+info.Op)
+		span.SetAttribute("db.system", dbSystem(info.DriverName))
+		span.SetAttribute("db.operation", info.Op)
+		span.SetAttribute("db.statement", info.Query)
+		err := next(ctx)
+		if info.RowsAffected >= 0 {
+			span.SetAttribute("db.rows_affected", info.RowsAffected)
+		}
+		if info.IsErr() {
+			span.Err = info.Err
+		}
+		span.End()
+		if export != nil {
+			export(span)
+		}
+		return err
+	}
+}
+
+// dbSystem 驱动名称转换为 db.system
+func dbSystem(driverName string) string {
+	switch driverName {
+	case "", "mysql":
+		return "mysql"
+	case "postgres", "pgx":
+		return "postgresql"
+	case "sqlite3", "sqlite":
+		return "sqlite"
+	}
+	return driverName
+}
+
+// randomHex 随机id
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
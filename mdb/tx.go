@@ -0,0 +1,181 @@
+package mdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CommitError 提交事务时的错误,此时事务是否已提交不确定
+type CommitError struct {
+	Err error
+}
+
+// Error 错误信息
+func (e *CommitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 原始错误
+func (e *CommitError) Unwrap() error {
+	return e.Err
+}
+
+// txBeginAble 可以开始事务的数据库
+type txBeginAble interface {
+	beginTx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, ExecuteAble, error)
+}
+
+// Tx 事务,传入 Transaction 回调中的 ExecuteAble
+// 在回调中再次调用 Transaction 会创建 SAVEPOINT
+type Tx struct {
+	ExecuteAble
+
+	tx          *sqlx.Tx
+	root        *Tx
+	savepointID int64
+	hooks       []func()
+	// isExternal 外部传入的原始事务,提交由外部负责
+	isExternal bool
+}
+
+// SQLTx 获取原始事务
+func (t *Tx) SQLTx() *sqlx.Tx {
+	return t.tx
+}
+
+// AfterCommit 注册事务提交成功后执行的函数
+// 在保存点中注册的函数会在保存点回滚时丢弃
+// tx 不是事务时立即执行
+// tx 是外部传入的 *sqlx.Tx 时无法得知提交结果,返回错误
+func AfterCommit(tx ExecuteAble, hook func()) error {
+	switch t := tx.(type) {
+	case *Tx:
+		if t.root != nil && t.root.isExternal {
+			return fmt.Errorf("after commit not support in external tx")
+		}
+		t.hooks = append(t.hooks, hook)
+		return nil
+	case *sqlx.Tx:
+		return fmt.Errorf("after commit not support in external tx")
+	}
+	hook()
+	return nil
+}
+
+// Transaction 执行事物
+// db 已经是事务时使用 SAVEPOINT 嵌套执行
+func Transaction(ctx context.Context, db ExecuteAble, f func(dbTx ExecuteAble) error) error {
+	return TransactionOpts(ctx, db, nil, f)
+}
+
+// TransactionOpts 使用指定隔离级别和只读选项执行事物
+// 嵌套事务沿用外层事务的选项, opts 不生效
+func TransactionOpts(ctx context.Context, db ExecuteAble, opts *sql.TxOptions, f func(dbTx ExecuteAble) error) error {
+	switch v := db.(type) {
+	case *Tx:
+		return savepoint(ctx, v, f)
+	case *sqlx.Tx:
+		// 外部传入的原始事务,提交由外部负责,不能注册提交钩子
+		parent := &Tx{
+			ExecuteAble: v,
+			tx:          v,
+			isExternal:  true,
+		}
+		return savepoint(ctx, parent, f)
+	case *sqlx.DB:
+		return beginTransaction(ctx, db, f, func() (*sqlx.Tx, ExecuteAble, error) {
+			tx, err := v.BeginTxx(ctx, opts)
+			return tx, tx, err
+		})
+	case txBeginAble:
+		return beginTransaction(ctx, db, f, func() (*sqlx.Tx, ExecuteAble, error) {
+			return v.beginTx(ctx, opts)
+		})
+	}
+	return fmt.Errorf("transaction not support: %T", db)
+}
+
+// beginTransaction 开始新事务, BEGIN COMMIT ROLLBACK 经过拦截器
+// 事务的生命周期使用调用方的 ctx, 拦截器传入的 ctx 不生效
+func beginTransaction(ctx context.Context, db ExecuteAble, f func(dbTx ExecuteAble) error, begin func() (*sqlx.Tx, ExecuteAble, error)) error {
+	isComment := false
+	var tx *sqlx.Tx
+	var execTx ExecuteAble
+	err := intercept(ctx, db, OpBegin, "BEGIN", nil, func(context.Context) (int64, error) {
+		var err error
+		tx, execTx, err = begin()
+		return -1, err
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !isComment {
+			_ = intercept(ctx, db, OpRollback, "ROLLBACK", nil, func(context.Context) (int64, error) {
+				return -1, tx.Rollback()
+			})
+		}
+	}()
+	t := &Tx{
+		ExecuteAble: execTx,
+		tx:          tx,
+	}
+	t.root = t
+	err = f(t)
+	if err != nil {
+		return err
+	}
+	err = intercept(ctx, db, OpCommit, "COMMIT", nil, func(context.Context) (int64, error) {
+		return -1, tx.Commit()
+	})
+	// 提交失败时事务已经结束,不需要回滚
+	isComment = true
+	if err != nil {
+		return &CommitError{Err: err}
+	}
+	for _, hook := range t.hooks {
+		hook()
+	}
+	return nil
+}
+
+// savepoint 在事务中使用保存点执行
+func savepoint(ctx context.Context, parent *Tx, f func(dbTx ExecuteAble) error) error {
+	root := parent.root
+	if root == nil {
+		root = parent
+		parent.root = parent
+	}
+	root.savepointID++
+	name := "sp_" + strconv.FormatInt(root.savepointID, 10)
+	_, err := execIntercept(ctx, parent.tx, "SAVEPOINT "+name, nil)
+	if err != nil {
+		return err
+	}
+	isRelease := false
+	defer func() {
+		if !isRelease {
+			_, _ = execIntercept(ctx, parent.tx, "ROLLBACK TO SAVEPOINT "+name, nil)
+		}
+	}()
+	child := &Tx{
+		ExecuteAble: parent.ExecuteAble,
+		tx:          parent.tx,
+		root:        root,
+	}
+	err = f(child)
+	if err != nil {
+		return err
+	}
+	_, err = execIntercept(ctx, parent.tx, "RELEASE SAVEPOINT "+name, nil)
+	if err != nil {
+		return err
+	}
+	isRelease = true
+	parent.hooks = append(parent.hooks, child.hooks...)
+	return nil
+}
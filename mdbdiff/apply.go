@@ -0,0 +1,363 @@
+package mdbdiff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/moremorefun/mtool/mdb"
+	"github.com/moremorefun/mtool/mlog"
+)
+
+// 变更类型
+const (
+	// ChangeAdditive 新增表、列、索引
+	ChangeAdditive = 1
+	// ChangeModifying 修改列、删除索引等,不删除数据但可能锁表或截断
+	ChangeModifying = 2
+	// ChangeDestructive 删除表、列等会丢失数据的变更,无法识别的语句也视为此类
+	ChangeDestructive = 3
+)
+
+// ChangeName 变更类型名称
+func ChangeName(kind int64) string {
+	switch kind {
+	case ChangeAdditive:
+		return "additive"
+	case ChangeModifying:
+		return "modifying"
+	case ChangeDestructive:
+		return "destructive"
+	}
+	return "unknown"
+}
+
+// Statement 差异中的一条语句
+type Statement struct {
+	SQL  string
+	Kind int64
+	// Table 表名,视图、触发器和存储过程为对象名
+	Table string
+}
+
+// Diff 解析后的差异
+type Diff struct {
+	Statements []Statement
+	// IsForeignKeyChecksOff 差异中关闭了外键检查,执行时在同一个链接上关闭
+	IsForeignKeyChecksOff bool
+}
+
+// ApplyConfig 执行配置,默认只执行新增类语句
+type ApplyConfig struct {
+	AllowModifying   bool
+	AllowDestructive bool
+	// DryRun 只输出不执行
+	DryRun bool
+}
+
+// ApplyResult 执行结果
+type ApplyResult struct {
+	Applied []Statement
+	Skipped []Statement
+}
+
+// GetDiff 获取解析后的数据库更新指令
+func GetDiff(tx mdb.ExecuteAble, tableNames []string, sqlFilePath string) (*Diff, error) {
+	diffSQL, err := GetDiffSQL(tx, tableNames, sqlFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDiff(diffSQL), nil
+}
+
+// ParseDiff 解析差异sql,忽略 BEGIN COMMIT SET 等控制语句
+// SET FOREIGN_KEY_CHECKS=0 记录到 IsForeignKeyChecksOff
+func ParseDiff(diffSQL string) *Diff {
+	d := &Diff{}
+	for _, s := range SplitStatements(diffSQL) {
+		words := strings.Fields(strings.ToUpper(s))
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "SET":
+			if strings.Join(words, "") == "SETFOREIGN_KEY_CHECKS=0" {
+				d.IsForeignKeyChecksOff = true
+			}
+			continue
+		case "BEGIN", "COMMIT", "START", "ROLLBACK":
+			continue
+		}
+		d.Statements = append(d.Statements, classifyStatement(s))
+	}
+	return d
+}
+
+// Kind 最高的变更类型,没有语句时返回0
+func (d *Diff) Kind() int64 {
+	var kind int64
+	for _, s := range d.Statements {
+		if s.Kind > kind {
+			kind = s.Kind
+		}
+	}
+	return kind
+}
+
+// Filter 获取指定类型的语句
+func (d *Diff) Filter(kind int64) []Statement {
+	var statements []Statement
+	for _, s := range d.Statements {
+		if s.Kind == kind {
+			statements = append(statements, s)
+		}
+	}
+	return statements
+}
+
+// String 生成带类型注释的sql
+func (d *Diff) String() string {
+	var buf strings.Builder
+	if d.IsForeignKeyChecksOff {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	}
+	for _, s := range d.Statements {
+		buf.WriteString("-- ")
+		buf.WriteString(ChangeName(s.Kind))
+		buf.WriteString("\n")
+		buf.WriteString(s.SQL)
+		buf.WriteString(";\n")
+	}
+	if d.IsForeignKeyChecksOff {
+		buf.WriteString("SET FOREIGN_KEY_CHECKS=1;\n")
+	}
+	return buf.String()
+}
+
+// classifyStatement 判断语句类型
+func classifyStatement(s string) Statement {
+	statement := Statement{
+		SQL:  s,
+		Kind: ChangeDestructive,
+	}
+	words := strings.Fields(s)
+	upperWords := strings.Fields(strings.ToUpper(s))
+	if len(upperWords) < 3 {
+		return statement
+	}
+	tableName := func(i int) string {
+		if i < len(upperWords) && upperWords[i] == "IF" {
+			// IF [NOT] EXISTS
+			for i < len(upperWords) && upperWords[i] != "EXISTS" {
+				i++
+			}
+			i++
+		}
+		if i >= len(words) {
+			return ""
+		}
+		word := words[i]
+		if j := strings.IndexAny(word, "(,"); j >= 0 {
+			word = word[:j]
+		}
+		return strings.Trim(word, "`")
+	}
+	switch {
+	case upperWords[0] == "CREATE" && upperWords[1] == "TABLE":
+		statement.Kind = ChangeAdditive
+		statement.Table = tableName(2)
+	case upperWords[0] == "CREATE" && (upperWords[1] == "INDEX" || upperWords[2] == "INDEX"):
+		statement.Kind = ChangeAdditive
+		for i, w := range upperWords {
+			if w == "ON" {
+				statement.Table = tableName(i + 1)
+				break
+			}
+		}
+	case upperWords[0] == "DROP" && upperWords[1] == "INDEX":
+		statement.Kind = ChangeModifying
+		for i, w := range upperWords {
+			if w == "ON" {
+				statement.Table = tableName(i + 1)
+				break
+			}
+		}
+	case upperWords[0] == "DROP" && upperWords[1] == "TABLE":
+		statement.Table = tableName(2)
+	case upperWords[0] == "DROP" &&
+		(upperWords[1] == ObjectView || upperWords[1] == ObjectTrigger || upperWords[1] == ObjectProcedure || upperWords[1] == ObjectFunction):
+		// 视图、触发器和存储过程不保存数据
+		statement.Kind = ChangeModifying
+		statement.Table = tableName(2)
+	case upperWords[0] == "CREATE":
+		matches := objectRegexp.FindStringSubmatch(s)
+		if matches != nil {
+			statement.Kind = ChangeAdditive
+			statement.Table = strings.Trim(matches[2], "`")
+		}
+	case upperWords[0] == "ALTER" && upperWords[1] == "TABLE":
+		statement.Table = tableName(2)
+		clauses := splitTopLevel(s[fieldEnd(s, 2):])
+		var kind int64
+		for _, clause := range clauses {
+			clauseKind := classifyAlterClause(clause)
+			if clauseKind > kind {
+				kind = clauseKind
+			}
+		}
+		if kind > 0 {
+			statement.Kind = kind
+		}
+	}
+	return statement
+}
+
+// classifyAlterClause 判断 ALTER TABLE 子句类型
+func classifyAlterClause(clause string) int64 {
+	// 表选项可以写成 ENGINE=InnoDB
+	words := strings.FieldsFunc(strings.ToUpper(clause), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '='
+	})
+	if len(words) == 0 {
+		return 0
+	}
+	switch words[0] {
+	case "ADD":
+		return ChangeAdditive
+	case "MODIFY", "CHANGE", "ALTER", "ENGINE", "DEFAULT", "CHARACTER", "CHARSET", "COLLATE", "COMMENT", "AUTO_INCREMENT", "ROW_FORMAT", "CONVERT":
+		return ChangeModifying
+	case "DROP":
+		if len(words) > 1 {
+			switch words[1] {
+			case "INDEX", "KEY", "PRIMARY", "FOREIGN", "CONSTRAINT", "CHECK":
+				return ChangeModifying
+			}
+		}
+		return ChangeDestructive
+	}
+	return ChangeDestructive
+}
+
+// fieldEnd 第 n 个空白分隔的词结束的位置, n 从0开始
+func fieldEnd(s string, n int) int {
+	i := 0
+	for field := 0; field <= n; field++ {
+		for i < len(s) && unicode.IsSpace(rune(s[i])) {
+			i++
+		}
+		for i < len(s) && !unicode.IsSpace(rune(s[i])) {
+			i++
+		}
+	}
+	return i
+}
+
+// splitTopLevel 按不在括号和字符串中的逗号拆分
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// execAble 执行语句
+type execAble interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// ApplyDiff 逐条执行差异,遇到错误立即停止
+// 默认只执行新增类语句,修改和删除类语句需要在 conf 中允许,未允许的语句被跳过
+// 差异中关闭了外键检查时 tx 需要是 *sqlx.DB、Cluster 或事务,其他链接池无法保证使用同一个链接
+func ApplyDiff(ctx context.Context, tx mdb.ExecuteAble, d *Diff, conf ApplyConfig) (result *ApplyResult, err error) {
+	result = &ApplyResult{}
+	var allowed []Statement
+	for _, s := range d.Statements {
+		isAllow := s.Kind == ChangeAdditive ||
+			(s.Kind == ChangeModifying && conf.AllowModifying) ||
+			(s.Kind == ChangeDestructive && conf.AllowDestructive)
+		if !isAllow {
+			mlog.Log.Warnf("schema apply skip %s:\n%s;", ChangeName(s.Kind), s.SQL)
+			result.Skipped = append(result.Skipped, s)
+			continue
+		}
+		allowed = append(allowed, s)
+	}
+	var exec execAble = tx
+	if d.IsForeignKeyChecksOff && !conf.DryRun && len(allowed) > 0 {
+		// 外键检查是会话变量,关闭和执行需要使用同一个链接
+		var db *sqlx.DB
+		switch v := tx.(type) {
+		case *sqlx.DB:
+			db = v
+		case interface{ Primary() *sqlx.DB }:
+			db = v.Primary()
+		case *mdb.Tx, *sqlx.Tx:
+		default:
+			return result, fmt.Errorf("schema apply foreign key checks off need *sqlx.DB, cluster or transaction: %T", tx)
+		}
+		if db != nil {
+			conn, err := db.Connx(ctx)
+			if err != nil {
+				return result, err
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+			exec = conn
+		}
+		_, err = exec.ExecContext(ctx, "SET @mdbdiff_foreign_key_checks=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0")
+		if err != nil {
+			return result, err
+		}
+		defer func() {
+			_, restoreErr := exec.ExecContext(context.Background(), "SET FOREIGN_KEY_CHECKS=@mdbdiff_foreign_key_checks")
+			if err == nil {
+				err = restoreErr
+			}
+		}()
+	}
+	for i, s := range allowed {
+		if conf.DryRun {
+			mlog.Log.Infof("schema apply dry run [%d/%d] %s:\n%s;", i+1, len(allowed), ChangeName(s.Kind), s.SQL)
+			result.Applied = append(result.Applied, s)
+			continue
+		}
+		mlog.Log.Infof("schema apply [%d/%d] %s:\n%s;", i+1, len(allowed), ChangeName(s.Kind), s.SQL)
+		_, err = exec.ExecContext(ctx, s.SQL)
+		if err != nil {
+			return result, fmt.Errorf("schema apply [%d/%d] error: %w", i+1, len(allowed), err)
+		}
+		result.Applied = append(result.Applied, s)
+	}
+	return result, nil
+}
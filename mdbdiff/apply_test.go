@@ -0,0 +1,115 @@
+package mdbdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		kind  int64
+		table string
+	}{
+		{name: "create table", s: "CREATE TABLE `user` (id INT)", kind: ChangeAdditive, table: "user"},
+		{name: "create table if not exists", s: "create table if not exists user(id INT)", kind: ChangeAdditive, table: "user"},
+		{name: "create index", s: "CREATE INDEX idx_a ON `user` (a)", kind: ChangeAdditive, table: "user"},
+		{name: "create unique index", s: "CREATE UNIQUE INDEX idx_a ON user (a)", kind: ChangeAdditive, table: "user"},
+		{name: "drop index", s: "DROP INDEX idx_a ON `user`", kind: ChangeModifying, table: "user"},
+		{name: "drop table", s: "DROP TABLE IF EXISTS `user`", kind: ChangeDestructive, table: "user"},
+		{name: "drop view", s: "DROP VIEW `v_user`", kind: ChangeModifying, table: "v_user"},
+		{name: "create view", s: "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `v_user` AS SELECT 1", kind: ChangeAdditive, table: "v_user"},
+		{name: "create trigger", s: "CREATE TRIGGER t_user BEFORE INSERT ON user FOR EACH ROW SET NEW.a = 1", kind: ChangeAdditive, table: "t_user"},
+		{name: "alter add", s: "ALTER TABLE `user` ADD COLUMN `a` INT, ADD INDEX idx_a (a)", kind: ChangeAdditive, table: "user"},
+		{name: "alter modify", s: "ALTER TABLE `user` ADD COLUMN `a` INT, MODIFY COLUMN `b` DECIMAL(10,2)", kind: ChangeModifying, table: "user"},
+		{name: "alter drop column", s: "ALTER TABLE `user` DROP INDEX idx_a, DROP COLUMN `a`", kind: ChangeDestructive, table: "user"},
+		{name: "alter comma in string", s: "ALTER TABLE `user` MODIFY `a` INT COMMENT 'x, DROP y'", kind: ChangeModifying, table: "user"},
+		{name: "truncate", s: "TRUNCATE TABLE user", kind: ChangeDestructive},
+		{name: "short", s: "DROP x", kind: ChangeDestructive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyStatement(tt.s)
+			if got.SQL != tt.s || got.Kind != tt.kind || got.Table != tt.table {
+				t.Errorf("classifyStatement(%q) = %s %q, want %s %q", tt.s, ChangeName(got.Kind), got.Table, ChangeName(tt.kind), tt.table)
+			}
+		})
+	}
+}
+
+func TestClassifyAlterClause(t *testing.T) {
+	tests := []struct {
+		clause string
+		kind   int64
+	}{
+		{clause: " ADD COLUMN a INT", kind: ChangeAdditive},
+		{clause: "add unique key k (a)", kind: ChangeAdditive},
+		{clause: "MODIFY a BIGINT", kind: ChangeModifying},
+		{clause: "CHANGE a b INT", kind: ChangeModifying},
+		{clause: "ALTER a SET DEFAULT 1", kind: ChangeModifying},
+		{clause: "DEFAULT CHARSET=utf8mb4", kind: ChangeModifying},
+		{clause: "ENGINE=InnoDB", kind: ChangeModifying},
+		{clause: "DROP INDEX k", kind: ChangeModifying},
+		{clause: "DROP PRIMARY KEY", kind: ChangeModifying},
+		{clause: "DROP FOREIGN KEY fk", kind: ChangeModifying},
+		{clause: "DROP COLUMN a", kind: ChangeDestructive},
+		{clause: "DROP a", kind: ChangeDestructive},
+		{clause: "RENAME TO b", kind: ChangeDestructive},
+		{clause: "  ", kind: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clause, func(t *testing.T) {
+			got := classifyAlterClause(tt.clause)
+			if got != tt.kind {
+				t.Errorf("classifyAlterClause(%q) = %s, want %s", tt.clause, ChangeName(got), ChangeName(tt.kind))
+			}
+		})
+	}
+}
+
+func TestParseDiff(t *testing.T) {
+	tests := []struct {
+		name         string
+		diffSQL      string
+		isChecksOff  bool
+		kinds        []int64
+		expectedKind int64
+	}{
+		{
+			name:         "control statements",
+			diffSQL:      "SET FOREIGN_KEY_CHECKS = 0;\nBEGIN;\nCREATE TABLE a (id INT);\nALTER TABLE b DROP COLUMN c;\nCOMMIT;\nSET FOREIGN_KEY_CHECKS = 1;",
+			isChecksOff:  true,
+			kinds:        []int64{ChangeAdditive, ChangeDestructive},
+			expectedKind: ChangeDestructive,
+		},
+		{
+			name:         "checks on",
+			diffSQL:      "SET FOREIGN_KEY_CHECKS=1;\nALTER TABLE b MODIFY c INT;",
+			kinds:        []int64{ChangeModifying},
+			expectedKind: ChangeModifying,
+		},
+		{
+			name:    "empty",
+			diffSQL: "-- nothing\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := ParseDiff(tt.diffSQL)
+			if d.IsForeignKeyChecksOff != tt.isChecksOff {
+				t.Errorf("ParseDiff IsForeignKeyChecksOff = %v, want %v", d.IsForeignKeyChecksOff, tt.isChecksOff)
+			}
+			var kinds []int64
+			for _, s := range d.Statements {
+				kinds = append(kinds, s.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("ParseDiff kinds = %v, want %v", kinds, tt.kinds)
+			}
+			if d.Kind() != tt.expectedKind {
+				t.Errorf("Diff.Kind() = %d, want %d", d.Kind(), tt.expectedKind)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package mdbdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moremorefun/mtool/mdb"
+	"github.com/moremorefun/mtool/mlog"
+	"github.com/moremorefun/mtool/mquery"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// 数据变更类型
+const (
+	// DataInsert 源中有而目标中没有的行
+	DataInsert = 1
+	// DataDelete 目标中有而源中没有的行
+	DataDelete = 2
+	// DataUpdate 两边都有但字段不同的行
+	DataUpdate = 3
+)
+
+// DataName 数据变更类型名称
+func DataName(kind int64) string {
+	switch kind {
+	case DataInsert:
+		return "insert"
+	case DataDelete:
+		return "delete"
+	case DataUpdate:
+		return "update"
+	}
+	return "unknown"
+}
+
+// DataConfig 数据比较配置
+type DataConfig struct {
+	Table string
+	// Key 唯一键,两边都按此列排序后逐行比较
+	Key string
+	// Columns 读取的列,为空时读取所有列
+	Columns []string
+	// IgnoreColumns 不比较的列,如 updated_at, 新增的行仍然会写入
+	IgnoreColumns []string
+	// IsGenSQL 是否生成同步目标的sql
+	IsGenSQL bool
+	// Dialect 标识符使用的方言,默认 mquery.GetDefaultDialect()
+	Dialect mquery.Dialect
+}
+
+// ColumnDiff 字段差异
+type ColumnDiff struct {
+	Column string
+	Source interface{}
+	Target interface{}
+}
+
+// DataChange 一行的差异
+type DataChange struct {
+	Kind int64
+	Key  interface{}
+	// Row 新增和修改时为源中的行,删除时为目标中的行
+	Row gin.H
+	// Columns 修改时不同的字段
+	Columns []ColumnDiff
+	// SQL 同步目标的sql
+	SQL string
+}
+
+// DataDiff 数据差异
+type DataDiff struct {
+	Table   string
+	Key     string
+	Changes []DataChange
+}
+
+// Count 指定类型的变更数量
+func (d *DataDiff) Count(kind int64) int {
+	count := 0
+	for _, change := range d.Changes {
+		if change.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// String 差异描述,每行一个变更
+func (d *DataDiff) String() string {
+	var buf strings.Builder
+	for _, change := range d.Changes {
+		buf.WriteString(fmt.Sprintf("%s %s %s=%s", DataName(change.Kind), d.Table, d.Key, mdb.SQLLiteral(change.Key)))
+		for _, column := range change.Columns {
+			buf.WriteString(fmt.Sprintf(" %s:%s=>%s", column.Column, dataLiteral(column.Target), dataLiteral(column.Source)))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// SQL 同步目标的sql,需要 IsGenSQL
+func (d *DataDiff) SQL() string {
+	var buf strings.Builder
+	for _, change := range d.Changes {
+		if len(change.SQL) == 0 {
+			continue
+		}
+		buf.WriteString(change.SQL)
+		buf.WriteString(";\n")
+	}
+	return buf.String()
+}
+
+// DiffData 比较两个数据库中同一个表的数据,目标以源为准
+// 两边按 Key 排序后流式读取,不会把整表读入内存
+func DiffData(ctx context.Context, source, target mdb.ExecuteAble, conf DataConfig) (*DataDiff, error) {
+	if len(conf.Table) == 0 {
+		return nil, fmt.Errorf("table empty")
+	}
+	if len(conf.Key) == 0 {
+		return nil, fmt.Errorf("key empty")
+	}
+	query, err := dataQuery(conf)
+	if err != nil {
+		return nil, err
+	}
+	sourceCursor, err := mdb.CursorContent(ctx, source, query, gin.H{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = sourceCursor.Close()
+	}()
+	// 使用 Decimal 比较定点数
+	sourceCursor.Typed()
+	targetCursor, err := mdb.CursorContent(ctx, target, query, gin.H{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = targetCursor.Close()
+	}()
+	targetCursor.Typed()
+
+	ignores := map[string]bool{}
+	for _, column := range conf.IgnoreColumns {
+		ignores[column] = true
+	}
+	d := &DataDiff{
+		Table: conf.Table,
+		Key:   conf.Key,
+	}
+	sourceReader := dataReader{name: "source", key: conf.Key, cursor: sourceCursor}
+	targetReader := dataReader{name: "target", key: conf.Key, cursor: targetCursor}
+	sourceRow, err := sourceReader.next()
+	if err != nil {
+		return nil, err
+	}
+	targetRow, err := targetReader.next()
+	if err != nil {
+		return nil, err
+	}
+	for sourceRow != nil || targetRow != nil {
+		var change *DataChange
+		switch {
+		case targetRow == nil || (sourceRow != nil && compareKey(sourceRow[conf.Key], targetRow[conf.Key]) < 0):
+			change = &DataChange{
+				Kind: DataInsert,
+				Key:  sourceRow[conf.Key],
+				Row:  sourceRow,
+			}
+			sourceRow, err = sourceReader.next()
+		case sourceRow == nil || compareKey(sourceRow[conf.Key], targetRow[conf.Key]) > 0:
+			change = &DataChange{
+				Kind: DataDelete,
+				Key:  targetRow[conf.Key],
+				Row:  targetRow,
+			}
+			targetRow, err = targetReader.next()
+		default:
+			var columns []ColumnDiff
+			columns, err = diffColumns(sourceRow, targetRow, sourceCursor.Columns(), ignores)
+			if err != nil {
+				return nil, err
+			}
+			if len(columns) > 0 {
+				change = &DataChange{
+					Kind:    DataUpdate,
+					Key:     sourceRow[conf.Key],
+					Row:     sourceRow,
+					Columns: columns,
+				}
+			}
+			sourceRow, err = sourceReader.next()
+			if err != nil {
+				return nil, err
+			}
+			targetRow, err = targetReader.next()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if change == nil {
+			continue
+		}
+		if conf.IsGenSQL {
+			change.SQL = changeSQL(conf, sourceCursor.Columns(), change)
+		}
+		d.Changes = append(d.Changes, *change)
+	}
+	return d, nil
+}
+
+// ApplyData 在目标中逐条执行同步sql,遇到错误立即停止,返回已执行的数量
+// 比较时需要设置 IsGenSQL
+func ApplyData(ctx context.Context, tx mdb.ExecuteAble, d *DataDiff) (int, error) {
+	for i, change := range d.Changes {
+		if len(change.SQL) == 0 {
+			return i, fmt.Errorf("change sql empty")
+		}
+		mlog.Log.Infof("data apply [%d/%d] %s", i+1, len(d.Changes), change.SQL)
+		_, err := tx.ExecContext(ctx, change.SQL)
+		if err != nil {
+			return i, fmt.Errorf("data apply [%d/%d] error: %w", i+1, len(d.Changes), err)
+		}
+	}
+	return len(d.Changes), nil
+}
+
+// dataQuery 按键排序的查询
+func dataQuery(conf DataConfig) (string, error) {
+	d := dataDialect(conf)
+	q := mquery.Select().
+		Dialect(d).
+		From(mquery.ConvertRaw(d.Quote(conf.Table))).
+		OrderBys(mquery.ConvertRaw(d.Quote(conf.Key)))
+	if len(conf.Columns) == 0 {
+		q.Columns(mquery.ConvertRaw("*"))
+	} else {
+		q.Columns(mquery.ConvertRaw(d.Quote(conf.Key)))
+		for _, column := range conf.Columns {
+			if column != conf.Key {
+				q.Columns(mquery.ConvertRaw(d.Quote(column)))
+			}
+		}
+	}
+	query, _, err := q.ToSQL()
+	return query, err
+}
+
+// dataDialect 配置中的方言
+func dataDialect(conf DataConfig) mquery.Dialect {
+	if conf.Dialect == nil {
+		return mquery.GetDefaultDialect()
+	}
+	return conf.Dialect
+}
+
+// dataReader 按顺序读取行并检查键的顺序
+type dataReader struct {
+	name    string
+	key     string
+	cursor  *mdb.Cursor
+	lastKey interface{}
+	hasLast bool
+}
+
+// next 读取下一行,没有数据时返回 nil
+func (r *dataReader) next() (gin.H, error) {
+	if !r.cursor.Next() {
+		return nil, r.cursor.Err()
+	}
+	row, err := r.cursor.Map()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := row[r.key]
+	if !ok {
+		return nil, fmt.Errorf("no key column: %s", r.key)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%s key is null", r.name)
+	}
+	if r.hasLast {
+		c := compareKey(r.lastKey, key)
+		if c == 0 {
+			return nil, fmt.Errorf("%s key duplicate: %v", r.name, key)
+		}
+		if c > 0 {
+			// 数据库排序规则和字节序不一致,如不区分大小写的字符串
+			return nil, fmt.Errorf("%s key order mismatch: %v %v, use binary collation key", r.name, r.lastKey, key)
+		}
+	}
+	r.lastKey = key
+	r.hasLast = true
+	return row, nil
+}
+
+// compareKey 比较键,数字按大小比较,其它按字符串比较
+func compareKey(a, b interface{}) int {
+	ai, aok := keyInt(a)
+	bi, bok := keyInt(b)
+	if aok && bok {
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	}
+	au, aok := a.(uint64)
+	bu, bok := b.(uint64)
+	if aok && bok {
+		switch {
+		case au < bu:
+			return -1
+		case au > bu:
+			return 1
+		}
+		return 0
+	}
+	at, aok := a.(time.Time)
+	bt, bok := b.(time.Time)
+	if aok && bok {
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		}
+		return 0
+	}
+	ad, aok := a.(mdb.Decimal)
+	bd, bok := b.(mdb.Decimal)
+	if aok && bok {
+		return ad.Rat().Cmp(bd.Rat())
+	}
+	return strings.Compare(keyString(a), keyString(b))
+}
+
+// keyInt 整数键
+func keyInt(v interface{}) (int64, bool) {
+	switch tv := v.(type) {
+	case int64:
+		return tv, true
+	case uint64:
+		if tv <= 1<<63-1 {
+			return int64(tv), true
+		}
+	}
+	return 0, false
+}
+
+// keyString 字符串键
+func keyString(v interface{}) string {
+	switch tv := v.(type) {
+	case string:
+		return tv
+	case []byte:
+		return string(tv)
+	}
+	return fmt.Sprint(v)
+}
+
+// diffColumns 比较两行的字段
+func diffColumns(source, target gin.H, columns []string, ignores map[string]bool) ([]ColumnDiff, error) {
+	var diffs []ColumnDiff
+	for _, column := range columns {
+		if ignores[column] {
+			continue
+		}
+		targetValue, ok := target[column]
+		if !ok {
+			return nil, fmt.Errorf("target no column: %s", column)
+		}
+		if !valueEqual(source[column], targetValue) {
+			diffs = append(diffs, ColumnDiff{
+				Column: column,
+				Source: source[column],
+				Target: targetValue,
+			})
+		}
+	}
+	return diffs, nil
+}
+
+// valueEqual 字段值是否相同
+func valueEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch ta := a.(type) {
+	case time.Time:
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	case mdb.Decimal:
+		tb, ok := b.(mdb.Decimal)
+		return ok && ta.Rat().Cmp(tb.Rat()) == 0
+	case []byte:
+		tb, ok := b.([]byte)
+		return ok && bytes.Equal(ta, tb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// dataLiteral 生成sql字面量, json 字段重新编码,浮点数使用最短的精确表示
+func dataLiteral(v interface{}) string {
+	switch tv := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(tv), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(tv, 'g', -1, 64)
+	case map[string]interface{}, []interface{}:
+		b, err := jsoniter.Marshal(v)
+		if err == nil {
+			return mdb.SQLLiteral(string(b))
+		}
+	}
+	return mdb.SQLLiteral(v)
+}
+
+// changeSQL 生成同步目标的sql
+func changeSQL(conf DataConfig, columns []string, change *DataChange) string {
+	d := dataDialect(conf)
+	where := " WHERE " + d.Quote(conf.Key) + "=" + dataLiteral(change.Key)
+	switch change.Kind {
+	case DataInsert:
+		quoted := make([]string, 0, len(columns))
+		values := make([]string, 0, len(columns))
+		for _, column := range columns {
+			quoted = append(quoted, d.Quote(column))
+			values = append(values, dataLiteral(change.Row[column]))
+		}
+		return "INSERT INTO " + d.Quote(conf.Table) + " (" + strings.Join(quoted, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")"
+	case DataDelete:
+		return "DELETE FROM " + d.Quote(conf.Table) + where
+	case DataUpdate:
+		sets := make([]string, 0, len(change.Columns))
+		for _, column := range change.Columns {
+			sets = append(sets, d.Quote(column.Column)+"="+dataLiteral(column.Source))
+		}
+		return "UPDATE " + d.Quote(conf.Table) + " SET " + strings.Join(sets, ", ") + where
+	}
+	return ""
+}
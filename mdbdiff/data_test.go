@@ -0,0 +1,171 @@
+package mdbdiff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moremorefun/mtool/mdb"
+	"github.com/moremorefun/mtool/mquery"
+)
+
+// mustDecimal 测试用的 mdb.Decimal
+func mustDecimal(t *testing.T, s string) mdb.Decimal {
+	d, err := mdb.DecimalMake(s)
+	if err != nil {
+		t.Fatalf("DecimalMake(%q) error: %s", s, err)
+	}
+	return d
+}
+
+func TestCompareKey(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		a    interface{}
+		b    interface{}
+		want int
+	}{
+		{name: "int64", a: int64(2), b: int64(10), want: -1},
+		{name: "int64 equal", a: int64(7), b: int64(7), want: 0},
+		{name: "int64 and uint64", a: int64(-1), b: uint64(1), want: -1},
+		{name: "large uint64", a: uint64(1<<63 + 1), b: uint64(1 << 63), want: 1},
+		{name: "time", a: now, b: now.Add(time.Second), want: -1},
+		{name: "decimal", a: mustDecimal(t, "10.50"), b: mustDecimal(t, "10.5"), want: 0},
+		{name: "decimal order", a: mustDecimal(t, "9.9"), b: mustDecimal(t, "10"), want: -1},
+		{name: "string", a: "b", b: "a", want: 1},
+		{name: "bytes and string", a: []byte("a"), b: "a", want: 0},
+		{name: "bytes order", a: []byte("B"), b: []byte("a"), want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareKey(tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("compareKey(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffColumns(t *testing.T) {
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name    string
+		source  gin.H
+		target  gin.H
+		columns []string
+		ignores map[string]bool
+		want    []ColumnDiff
+		isError bool
+	}{
+		{
+			name:    "same",
+			source:  gin.H{"a": int64(1), "b": []byte("x"), "c": nil, "d": now, "e": mustDecimal(t, "1.0")},
+			target:  gin.H{"a": int64(1), "b": []byte("x"), "c": nil, "d": now.In(time.FixedZone("", 3600)), "e": mustDecimal(t, "1")},
+			columns: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:    "different",
+			source:  gin.H{"a": int64(1), "b": nil, "c": "x"},
+			target:  gin.H{"a": int64(2), "b": "", "c": "x"},
+			columns: []string{"a", "b", "c"},
+			want: []ColumnDiff{
+				{Column: "a", Source: int64(1), Target: int64(2)},
+				{Column: "b", Source: nil, Target: ""},
+			},
+		},
+		{
+			name:    "ignore",
+			source:  gin.H{"a": int64(1), "updated_at": now},
+			target:  gin.H{"a": int64(1), "updated_at": now.Add(time.Hour)},
+			columns: []string{"a", "updated_at"},
+			ignores: map[string]bool{"updated_at": true},
+		},
+		{
+			name:    "target no column",
+			source:  gin.H{"a": int64(1)},
+			target:  gin.H{},
+			columns: []string{"a"},
+			isError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := diffColumns(tt.source, tt.target, tt.columns, tt.ignores)
+			if tt.isError {
+				if err == nil {
+					t.Fatalf("diffColumns want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("diffColumns error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffColumns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    DataConfig
+		columns []string
+		change  *DataChange
+		want    string
+	}{
+		{
+			name:    "insert",
+			conf:    DataConfig{Table: "user", Key: "id"},
+			columns: []string{"id", "name", "score"},
+			change: &DataChange{
+				Kind: DataInsert,
+				Key:  int64(1),
+				Row:  gin.H{"id": int64(1), "name": "a'b", "score": 0.1},
+			},
+			want: "INSERT INTO `user` (`id`, `name`, `score`) VALUES (1, 'a\\'b', 0.1)",
+		},
+		{
+			name: "delete",
+			conf: DataConfig{Table: "user", Key: "id"},
+			change: &DataChange{
+				Kind: DataDelete,
+				Key:  "k",
+			},
+			want: "DELETE FROM `user` WHERE `id`='k'",
+		},
+		{
+			name: "update",
+			conf: DataConfig{Table: "user", Key: "id"},
+			change: &DataChange{
+				Kind: DataUpdate,
+				Key:  int64(1),
+				Columns: []ColumnDiff{
+					{Column: "score", Source: float32(0.1), Target: float32(0.2)},
+					{Column: "name", Source: nil, Target: "a"},
+				},
+			},
+			want: "UPDATE `user` SET `score`=0.1, `name`=NULL WHERE `id`=1",
+		},
+		{
+			name: "dialect",
+			conf: DataConfig{Table: "user", Key: "id", Dialect: mquery.DialectPostgres},
+			change: &DataChange{
+				Kind: DataDelete,
+				Key:  int64(1),
+			},
+			want: `DELETE FROM "user" WHERE "id"=1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changeSQL(tt.conf, tt.columns, tt.change)
+			if got != tt.want {
+				t.Errorf("changeSQL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
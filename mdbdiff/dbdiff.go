@@ -15,6 +15,16 @@ import (
 
 // GetDiffSQL 获取数据库更新指令
 func GetDiffSQL(tx mdb.ExecuteAble, tableNames []string, sqlFilePath string) (string, error) {
+	// 目的sql
+	toSQL, err := ioutil.ReadFile(sqlFilePath)
+	if err != nil {
+		return "", err
+	}
+	return GetDiffSQLString(tx, tableNames, string(toSQL))
+}
+
+// GetDiffSQLString 获取数据库到目的sql的更新指令
+func GetDiffSQLString(tx mdb.ExecuteAble, tableNames []string, toSQL string) (string, error) {
 	var dbSQLs []string
 	for _, tableName := range tableNames {
 		var row struct {
@@ -40,13 +50,8 @@ func GetDiffSQL(tx mdb.ExecuteAble, tableNames []string, sqlFilePath string) (st
 	}
 	// 原始sql
 	dbSQL := strings.Join(dbSQLs, "\n")
-	// 目的sql
-	toSQL, err := ioutil.ReadFile(sqlFilePath)
-	if err != nil {
-		return "", err
-	}
 	sqlDiff := new(bytes.Buffer)
-	err = diff.Strings(sqlDiff, dbSQL, string(toSQL), diff.WithTransaction(true))
+	err := diff.Strings(sqlDiff, dbSQL, toSQL, diff.WithTransaction(true))
 	if err != nil {
 		return "", err
 	}
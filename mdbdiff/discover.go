@@ -0,0 +1,354 @@
+package mdbdiff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// 对象类型
+const (
+	ObjectTable     = "TABLE"
+	ObjectView      = "VIEW"
+	ObjectTrigger   = "TRIGGER"
+	ObjectProcedure = "PROCEDURE"
+	ObjectFunction  = "FUNCTION"
+)
+
+// Object 数据库对象
+type Object struct {
+	Type string
+	Name string
+	// SQL 创建语句
+	SQL string
+}
+
+// Filter 对象名过滤, glob 格式,如 log_*, Include 为空时包含所有
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Match 是否匹配
+func (f Filter) Match(name string) bool {
+	for _, pattern := range f.Exclude {
+		ok, _ := path.Match(pattern, name)
+		if ok {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		ok, _ := path.Match(pattern, name)
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// showCreateColumns SHOW CREATE 结果中的创建语句列
+var showCreateColumns = map[string]string{
+	ObjectTable:     "Create Table",
+	ObjectView:      "Create View",
+	ObjectTrigger:   "SQL Original Statement",
+	ObjectProcedure: "Create Procedure",
+	ObjectFunction:  "Create Function",
+}
+
+// Discover 通过 information_schema 获取当前数据库的表、视图、触发器和存储过程
+func Discover(ctx context.Context, tx mdb.ExecuteAble, filter Filter) ([]Object, error) {
+	var objects []Object
+	queries := []string{
+		`SELECT
+    TABLE_NAME,
+    IF(TABLE_TYPE='VIEW', 'VIEW', 'TABLE')
+FROM
+    information_schema.TABLES
+WHERE
+    TABLE_SCHEMA=DATABASE()`,
+		`SELECT
+    TRIGGER_NAME,
+    'TRIGGER'
+FROM
+    information_schema.TRIGGERS
+WHERE
+    TRIGGER_SCHEMA=DATABASE()`,
+		`SELECT
+    ROUTINE_NAME,
+    ROUTINE_TYPE
+FROM
+    information_schema.ROUTINES
+WHERE
+    ROUTINE_SCHEMA=DATABASE()`,
+	}
+	for _, query := range queries {
+		rows, err := tx.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var object Object
+			err = rows.Scan(&object.Name, &object.Type)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			if filter.Match(object.Name) {
+				objects = append(objects, object)
+			}
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range objects {
+		createSQL, err := showCreate(ctx, tx, objects[i].Type, objects[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		objects[i].SQL = createSQL
+	}
+	sortObjects(objects)
+	return objects, nil
+}
+
+// showCreate 获取创建语句
+func showCreate(ctx context.Context, tx mdb.ExecuteAble, objectType, name string) (string, error) {
+	column, ok := showCreateColumns[objectType]
+	if !ok {
+		return "", fmt.Errorf("no object type: %s", objectType)
+	}
+	rows, err := tx.QueryContext(ctx, "SHOW CREATE "+objectType+" `"+strings.ReplaceAll(name, "`", "``")+"`")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		err = rows.Err()
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no create sql: %s %s", objectType, name)
+	}
+	values := make([]sql.RawBytes, len(columns))
+	points := make([]interface{}, len(columns))
+	for i := range values {
+		points[i] = &values[i]
+	}
+	err = rows.Scan(points...)
+	if err != nil {
+		return "", err
+	}
+	for i, c := range columns {
+		if c == column {
+			return string(values[i]), nil
+		}
+	}
+	return "", fmt.Errorf("no create column: %s", column)
+}
+
+// sortObjects 按类型和名称排序
+func sortObjects(objects []Object) {
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Type != objects[j].Type {
+			return objects[i].Type < objects[j].Type
+		}
+		return objects[i].Name < objects[j].Name
+	})
+}
+
+// objectRegexp 创建语句中的对象类型和名称
+var objectRegexp = regexp.MustCompile("(?is)^CREATE\\s+(?:OR\\s+REPLACE\\s+)?(?:ALGORITHM\\s*=\\s*\\w+\\s+)?(?:DEFINER\\s*=\\s*\\S+\\s+)?(?:SQL\\s+SECURITY\\s+\\w+\\s+)?(?:TEMPORARY\\s+)?(TABLE|VIEW|TRIGGER|PROCEDURE|FUNCTION)\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?((?:`[^`]+`|[\\w$]+)(?:\\.(?:`[^`]+`|[\\w$]+))?)")
+
+// ParseObjects 解析sql文件中的创建语句,其它语句忽略
+func ParseObjects(s string, filter Filter) []Object {
+	var objects []Object
+	for _, statement := range SplitStatements(s) {
+		matches := objectRegexp.FindStringSubmatch(stripLeadingComments(statement))
+		if matches == nil {
+			continue
+		}
+		name := matches[2]
+		index := strings.LastIndex(name, ".")
+		if index >= 0 {
+			name = name[index+1:]
+		}
+		name = strings.Trim(name, "`")
+		if !filter.Match(name) {
+			continue
+		}
+		objects = append(objects, Object{
+			Type: strings.ToUpper(matches[1]),
+			Name: name,
+			SQL:  statement,
+		})
+	}
+	sortObjects(objects)
+	return objects
+}
+
+// stripLeadingComments 去掉语句开头的注释
+func stripLeadingComments(s string) string {
+	for {
+		s = strings.TrimSpace(s)
+		switch {
+		case strings.HasPrefix(s, "--") || strings.HasPrefix(s, "#"):
+			index := strings.IndexByte(s, '\n')
+			if index < 0 {
+				return ""
+			}
+			s = s[index+1:]
+		case strings.HasPrefix(s, "/*") && !strings.HasPrefix(s, "/*!"):
+			index := strings.Index(s, "*/")
+			if index < 0 {
+				return ""
+			}
+			s = s[index+2:]
+		default:
+			return s
+		}
+	}
+}
+
+var (
+	definerRegexp  = regexp.MustCompile("(?i)DEFINER\\s*=\\s*(`[^`]*`|'[^']*'|\\w+)@(`[^`]*`|'[^']*'|[\\w%.]+)\\s*")
+	algorithmRegex = regexp.MustCompile(`(?i)ALGORITHM\s*=\s*\w+\s*`)
+	securityRegexp = regexp.MustCompile(`(?i)SQL\s+SECURITY\s+\w+\s*`)
+	replaceRegexp  = regexp.MustCompile(`(?i)^CREATE\s+OR\s+REPLACE\s+`)
+	spaceRegexp    = regexp.MustCompile(`\s+`)
+)
+
+// normalizeObjectSQL 比较前规范化创建语句,去掉 OR REPLACE DEFINER ALGORITHM SQL SECURITY 库名 反引号和多余空白
+func normalizeObjectSQL(s, schema string) string {
+	s = stripLeadingComments(s)
+	s = replaceRegexp.ReplaceAllString(s, "CREATE ")
+	s = definerRegexp.ReplaceAllString(s, "")
+	s = algorithmRegex.ReplaceAllString(s, "")
+	s = securityRegexp.ReplaceAllString(s, "")
+	if len(schema) > 0 {
+		s = strings.ReplaceAll(s, "`"+schema+"`.", "")
+	}
+	s = strings.ReplaceAll(s, "`", "")
+	s = spaceRegexp.ReplaceAllString(s, " ")
+	s = strings.TrimSuffix(strings.TrimSpace(s), ";")
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// GetSchemaDiff 自动发现当前数据库的对象并和sql文件双向比较
+// 表使用 schemalex 比较,视图、触发器和存储过程规范化后比较,不同时先删除再创建,删除和创建都是修改类
+// 视图会被数据库改写,只规范化文本后比较,文件中的视图使用 SHOW CREATE VIEW 导出的语句才不会被重建
+// 数据库中有而文件中没有的对象会被删除
+func GetSchemaDiff(ctx context.Context, tx mdb.ExecuteAble, sqlFilePath string, filter Filter) (*Diff, error) {
+	toSQL, err := ioutil.ReadFile(sqlFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return GetSchemaDiffString(ctx, tx, string(toSQL), filter)
+}
+
+// GetSchemaDiffString 自动发现当前数据库的对象并和sql双向比较
+func GetSchemaDiffString(ctx context.Context, tx mdb.ExecuteAble, toSQL string, filter Filter) (*Diff, error) {
+	dbObjects, err := Discover(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+	toObjects := ParseObjects(toSQL, filter)
+	var schema sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&schema)
+	if err != nil {
+		return nil, err
+	}
+
+	// 表
+	var tableNames []string
+	for _, object := range dbObjects {
+		if object.Type == ObjectTable {
+			tableNames = append(tableNames, object.Name)
+		}
+	}
+	var toTableSQLs []string
+	for _, object := range toObjects {
+		if object.Type == ObjectTable {
+			toTableSQLs = append(toTableSQLs, object.SQL+";")
+		}
+	}
+	tableDiff, err := GetDiffSQLString(tx, tableNames, strings.Join(toTableSQLs, "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 其它对象
+	key := func(object Object) string {
+		return object.Type + " " + object.Name
+	}
+	dbMap := map[string]Object{}
+	for _, object := range dbObjects {
+		if object.Type != ObjectTable {
+			dbMap[key(object)] = object
+		}
+	}
+	// isSame 文件中的对象和数据库中的相同
+	isSame := func(toObject, dbObject Object) bool {
+		return normalizeObjectSQL(toObject.SQL, schema.String) == normalizeObjectSQL(dbObject.SQL, schema.String)
+	}
+	toMap := map[string]Object{}
+	changed := map[string]bool{}
+	var creates []Statement
+	for _, object := range toObjects {
+		if object.Type == ObjectTable {
+			continue
+		}
+		toMap[key(object)] = object
+		dbObject, ok := dbMap[key(object)]
+		if ok && isSame(object, dbObject) {
+			continue
+		}
+		statement := classifyStatement(object.SQL)
+		if ok {
+			// 修改时先删除再创建,创建和删除使用相同的类型,避免只执行创建
+			statement.Kind = ChangeModifying
+			changed[key(object)] = true
+		}
+		creates = append(creates, statement)
+	}
+	var drops []string
+	for _, object := range dbObjects {
+		if object.Type == ObjectTable {
+			continue
+		}
+		_, ok := toMap[key(object)]
+		if ok && !changed[key(object)] {
+			continue
+		}
+		drops = append(drops, "DROP "+object.Type+" IF EXISTS `"+strings.ReplaceAll(object.Name, "`", "``")+"`")
+	}
+
+	tableStatements := ParseDiff(tableDiff)
+	d := &Diff{
+		IsForeignKeyChecksOff: tableStatements.IsForeignKeyChecksOff,
+	}
+	for _, s := range drops {
+		d.Statements = append(d.Statements, classifyStatement(s))
+	}
+	d.Statements = append(d.Statements, tableStatements.Statements...)
+	d.Statements = append(d.Statements, creates...)
+	return d, nil
+}
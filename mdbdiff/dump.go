@@ -0,0 +1,381 @@
+package mdbdiff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// autoIncrementRegexp 表选项中的自增计数
+var autoIncrementRegexp = regexp.MustCompile(`(?i)\s+AUTO_INCREMENT\s*=\s*\d+`)
+
+// DumpSchema 导出当前数据库所有表的创建语句,去掉自增计数,按表名排序
+func DumpSchema(ctx context.Context, tx mdb.ExecuteAble, filter Filter) (string, error) {
+	tables, err := DumpTables(ctx, tx, filter)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	for _, table := range tables {
+		buf.WriteString(table.SQL)
+		buf.WriteString(";\n\n")
+	}
+	return buf.String(), nil
+}
+
+// DumpTables 获取当前数据库所有表的创建语句,去掉自增计数
+func DumpTables(ctx context.Context, tx mdb.ExecuteAble, filter Filter) ([]Object, error) {
+	objects, err := Discover(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var tables []Object
+	for _, object := range objects {
+		if object.Type != ObjectTable {
+			continue
+		}
+		object.SQL = autoIncrementRegexp.ReplaceAllString(object.SQL, "")
+		tables = append(tables, object)
+	}
+	return tables, nil
+}
+
+// Column 表字段
+type Column struct {
+	Name string
+	// Type 字段类型,如 bigint(20) unsigned
+	Type     string
+	Nullable bool
+	Comment  string
+}
+
+// Table 表结构
+type Table struct {
+	Name    string
+	Comment string
+	Columns []Column
+}
+
+var (
+	tableNameRegexp = regexp.MustCompile("(?is)^\\s*CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?(`[^`]+`|\\w+)")
+	commentRegexp   = regexp.MustCompile(`(?i)\sCOMMENT\s*=?\s*'((?:[^'\\]|\\.|'')*)'`)
+)
+
+// ParseTable 解析 SHOW CREATE TABLE 的结果
+func ParseTable(createSQL string) (*Table, error) {
+	matches := tableNameRegexp.FindStringSubmatch(createSQL)
+	if matches == nil {
+		return nil, fmt.Errorf("no create table sql")
+	}
+	table := &Table{
+		Name: strings.Trim(matches[1], "`"),
+	}
+	table.Comment = unquoteComment(commentRegexp.FindStringSubmatch(tableOptions(createSQL)))
+	for _, line := range strings.Split(createSQL, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "`") {
+			continue
+		}
+		end := strings.Index(line[1:], "`")
+		if end < 0 {
+			continue
+		}
+		column := Column{
+			Name: line[1 : end+1],
+		}
+		rest := strings.TrimSpace(line[end+2:])
+		column.Type = columnType(rest)
+		words := topLevelWords(rest[len(column.Type):])
+		if len(words) > 0 && words[0] == "UNSIGNED" {
+			column.Type += " unsigned"
+		}
+		column.Nullable = !isNotNull(words)
+		column.Comment = unquoteComment(commentRegexp.FindStringSubmatch(rest))
+		table.Columns = append(table.Columns, column)
+	}
+	if len(table.Columns) == 0 {
+		return nil, fmt.Errorf("no columns: %s", table.Name)
+	}
+	return table, nil
+}
+
+// tableOptions 字段列表的右括号之后的表选项,括号和字符串中的内容不影响
+func tableOptions(createSQL string) string {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(createSQL); i++ {
+		c := createSQL[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return createSQL[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// topLevelWords 不在括号和字符串中的词,转为大写
+func topLevelWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, strings.ToUpper(word.String()))
+			word.Reset()
+		}
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			flush()
+			quote = c
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			depth--
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			flush()
+		case depth == 0:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return words
+}
+
+// isNotNull 字段属性中是否有 NOT NULL
+func isNotNull(words []string) bool {
+	for i := 0; i+1 < len(words); i++ {
+		if words[i] == "NOT" && words[i+1] == "NULL" {
+			return true
+		}
+	}
+	return false
+}
+
+// columnType 获取字段定义开头的类型,括号和字符串中的空格不拆分
+func columnType(s string) string {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ', ',':
+			if depth == 0 {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+// unquoteComment 还原注释中的转义
+func unquoteComment(matches []string) string {
+	if matches == nil {
+		return ""
+	}
+	return strings.NewReplacer(`\\`, `\`, `\'`, `'`, `''`, `'`, `\n`, " ", `\r`, " ", `\t`, " ").Replace(matches[1])
+}
+
+// goTypeNames go类型对应的代码
+var goTypeNames = map[int64]string{
+	mdb.GoTypeString:  "string",
+	mdb.GoTypeInt64:   "int64",
+	mdb.GoTypeBytes:   "[]byte",
+	mdb.GoTypeFloat64: "float64",
+	mdb.GoTypeTime:    "time.Time",
+	mdb.GoTypeUint64:  "uint64",
+	mdb.GoTypeDecimal: "mdb.Decimal",
+	mdb.GoTypeJSON:    "string",
+	mdb.GoTypeBool:    "bool",
+	mdb.GoTypeAny:     "interface{}",
+}
+
+// GoType 字段对应的go类型,可以为空的字段使用指针
+func (c Column) GoType() string {
+	dbType := strings.ToUpper(strings.TrimSpace(c.Type))
+	isUnsigned := strings.HasSuffix(dbType, " UNSIGNED")
+	dbType = strings.TrimSuffix(dbType, " UNSIGNED")
+	index := strings.Index(dbType, "(")
+	if index != -1 {
+		dbType = dbType[:index]
+	}
+	if isUnsigned {
+		dbType = "UNSIGNED " + dbType
+	}
+	goType, ok := mdb.TypeMySQLToGoMap[dbType]
+	if !ok {
+		goType, ok = mdb.GoTypeByDBType(strings.TrimPrefix(dbType, "UNSIGNED "))
+		if !ok {
+			goType = mdb.GoTypeString
+		}
+	}
+	name := goTypeNames[goType]
+	if c.Nullable && goType != mdb.GoTypeBytes && goType != mdb.GoTypeAny {
+		name = "*" + name
+	}
+	return name
+}
+
+// commonInitialisms 转换为全大写的缩写
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true,
+	"GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true,
+	"QPS": true, "RAM": true, "RPC": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true,
+	"TTL": true, "UI": true, "UID": true, "UUID": true, "URI": true, "URL": true, "XML": true,
+}
+
+// GoName 下划线名称转换为go名称,如 user_id 转换为 UserID
+func GoName(s string) string {
+	var buf strings.Builder
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		upper := strings.ToUpper(word)
+		if commonInitialisms[upper] {
+			buf.WriteString(upper)
+			continue
+		}
+		buf.WriteString(strings.ToUpper(word[:1]))
+		buf.WriteString(word[1:])
+	}
+	name := buf.String()
+	if len(name) == 0 || (name[0] >= '0' && name[0] <= '9') {
+		name = "T" + name
+	}
+	return name
+}
+
+// GenStruct 生成表对应的go代码,包含带 db json 标签的结构体和表名字段名常量
+// 常量格式为 Table<表名> Col<表名><字段名>,可直接用于 mquery
+// 时间字段为 time.Time,读取时 dsn 需要设置 parseTime=true
+func GenStruct(pkg string, table *Table) ([]byte, error) {
+	structName := GoName(table.Name)
+	isTime := false
+	isMdb := false
+	for _, column := range table.Columns {
+		goType := column.GoType()
+		isTime = isTime || strings.HasSuffix(goType, "time.Time")
+		isMdb = isMdb || strings.HasSuffix(goType, "mdb.Decimal")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by mdbgen. DO NOT EDIT.\n\n")
+	buf.WriteString("package " + pkg + "\n\n")
+	if isTime || isMdb {
+		buf.WriteString("import (\n")
+		if isTime {
+			buf.WriteString("\"time\"\n")
+		}
+		if isMdb {
+			buf.WriteString("\n\"github.com/moremorefun/mtool/mdb\"\n")
+		}
+		buf.WriteString(")\n\n")
+	}
+
+	buf.WriteString("// 表 " + table.Name + "\n")
+	buf.WriteString("const (\n")
+	buf.WriteString(fmt.Sprintf("Table%s = %q\n", structName, table.Name))
+	for _, column := range table.Columns {
+		buf.WriteString(fmt.Sprintf("Col%s%s = %q\n", structName, GoName(column.Name), column.Name))
+	}
+	buf.WriteString(")\n\n")
+
+	comment := table.Comment
+	if len(comment) == 0 {
+		comment = table.Name
+	}
+	buf.WriteString(fmt.Sprintf("// %s %s\n", structName, comment))
+	buf.WriteString(fmt.Sprintf("type %s struct {\n", structName))
+	for _, column := range table.Columns {
+		if len(column.Comment) > 0 {
+			buf.WriteString("// " + GoName(column.Name) + " " + column.Comment + "\n")
+		}
+		buf.WriteString(fmt.Sprintf("%s %s `db:%q json:%q`\n", GoName(column.Name), column.GoType(), column.Name, column.Name))
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
+
+// GenStructs 生成当前数据库所有表的go代码,返回文件名到内容的映射
+func GenStructs(ctx context.Context, tx mdb.ExecuteAble, pkg string, filter Filter) (map[string][]byte, error) {
+	tables, err := DumpTables(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	var names []string
+	for _, object := range tables {
+		table, err := ParseTable(object.SQL)
+		if err != nil {
+			return nil, err
+		}
+		code, err := GenStruct(pkg, table)
+		if err != nil {
+			return nil, fmt.Errorf("gen struct %s error: %w", table.Name, err)
+		}
+		name := strings.ToLower(GoName(table.Name))
+		files[name+".go"] = code
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] {
+			return nil, fmt.Errorf("duplicate file name: %s.go", names[i])
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,195 @@
+package mdbdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+// userCreateSQL 测试用的 SHOW CREATE TABLE 结果
+const userCreateSQL = "CREATE TABLE `user_info` (\n" +
+	"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'user id',\n" +
+	"  `name` varchar(64) NOT NULL DEFAULT '' COMMENT 'it''s, (name)',\n" +
+	"  `price` decimal(10,2) DEFAULT NULL,\n" +
+	"  `kind` enum('a b','c') NOT NULL DEFAULT 'a b',\n" +
+	"  `avatar` blob,\n" +
+	"  `created_at` datetime NOT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_name` (`name`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4 COMMENT='用户\\'s info'"
+
+func TestParseTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		createSQL string
+		want      *Table
+		isError   bool
+	}{
+		{
+			name:      "columns",
+			createSQL: userCreateSQL,
+			want: &Table{
+				Name:    "user_info",
+				Comment: "用户's info",
+				Columns: []Column{
+					{Name: "id", Type: "bigint(20) unsigned", Comment: "user id"},
+					{Name: "name", Type: "varchar(64)", Comment: "it's, (name)"},
+					{Name: "price", Type: "decimal(10,2)", Nullable: true},
+					{Name: "kind", Type: "enum('a b','c')"},
+					{Name: "avatar", Type: "blob", Nullable: true},
+					{Name: "created_at", Type: "datetime"},
+				},
+			},
+		},
+		{
+			name:      "column comment is not table comment",
+			createSQL: "CREATE TABLE IF NOT EXISTS t (\n  `a` int COMMENT 'x'\n) ENGINE=InnoDB",
+			want: &Table{
+				Name:    "t",
+				Columns: []Column{{Name: "a", Type: "int", Nullable: true, Comment: "x"}},
+			},
+		},
+		{
+			name:      "not create table",
+			createSQL: "CREATE VIEW v AS SELECT 1",
+			isError:   true,
+		},
+		{
+			name:      "no columns",
+			createSQL: "CREATE TABLE t (\n  PRIMARY KEY (`id`)\n)",
+			isError:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTable(tt.createSQL)
+			if tt.isError {
+				if err == nil {
+					t.Fatalf("ParseTable want error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTable error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTable = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnGoType(t *testing.T) {
+	tests := []struct {
+		column Column
+		want   string
+	}{
+		{column: Column{Type: "bigint(20) unsigned"}, want: "uint64"},
+		{column: Column{Type: "int(11)"}, want: "int64"},
+		{column: Column{Type: "varchar(64)", Nullable: true}, want: "*string"},
+		{column: Column{Type: "decimal(10,2)"}, want: "mdb.Decimal"},
+		{column: Column{Type: "datetime", Nullable: true}, want: "*time.Time"},
+		{column: Column{Type: "blob", Nullable: true}, want: "[]byte"},
+		{column: Column{Type: "double"}, want: "float64"},
+		{column: Column{Type: "unknown_type"}, want: "string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column.Type, func(t *testing.T) {
+			got := tt.column.GoType()
+			if got != tt.want {
+				t.Errorf("GoType(%q) = %s, want %s", tt.column.Type, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "user_id", want: "UserID"},
+		{s: "api_url", want: "APIURL"},
+		{s: "created_at", want: "CreatedAt"},
+		{s: "user-info", want: "UserInfo"},
+		{s: "1st", want: "T1st"},
+		{s: "", want: "T"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got := GoName(tt.s)
+			if got != tt.want {
+				t.Errorf("GoName(%q) = %s, want %s", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenStruct(t *testing.T) {
+	tests := []struct {
+		name      string
+		createSQL string
+		want      string
+	}{
+		{
+			name:      "imports",
+			createSQL: userCreateSQL,
+			want: "// Code generated by mdbgen. DO NOT EDIT.\n\n" +
+				"package model\n\n" +
+				"import (\n" +
+				"\t\"time\"\n\n" +
+				"\t\"github.com/moremorefun/mtool/mdb\"\n" +
+				")\n\n" +
+				"// 表 user_info\n" +
+				"const (\n" +
+				"\tTableUserInfo        = \"user_info\"\n" +
+				"\tColUserInfoID        = \"id\"\n" +
+				"\tColUserInfoName      = \"name\"\n" +
+				"\tColUserInfoPrice     = \"price\"\n" +
+				"\tColUserInfoKind      = \"kind\"\n" +
+				"\tColUserInfoAvatar    = \"avatar\"\n" +
+				"\tColUserInfoCreatedAt = \"created_at\"\n" +
+				")\n\n" +
+				"// UserInfo 用户's info\n" +
+				"type UserInfo struct {\n" +
+				"\t// ID user id\n" +
+				"\tID uint64 `db:\"id\" json:\"id\"`\n" +
+				"\t// Name it's, (name)\n" +
+				"\tName      string       `db:\"name\" json:\"name\"`\n" +
+				"\tPrice     *mdb.Decimal `db:\"price\" json:\"price\"`\n" +
+				"\tKind      string       `db:\"kind\" json:\"kind\"`\n" +
+				"\tAvatar    []byte       `db:\"avatar\" json:\"avatar\"`\n" +
+				"\tCreatedAt time.Time    `db:\"created_at\" json:\"created_at\"`\n" +
+				"}\n",
+		},
+		{
+			name:      "no imports",
+			createSQL: "CREATE TABLE `t` (\n  `a` int NOT NULL\n)",
+			want: "// Code generated by mdbgen. DO NOT EDIT.\n\n" +
+				"package model\n\n" +
+				"// 表 t\n" +
+				"const (\n" +
+				"\tTableT = \"t\"\n" +
+				"\tColTA  = \"a\"\n" +
+				")\n\n" +
+				"// T t\n" +
+				"type T struct {\n" +
+				"\tA int64 `db:\"a\" json:\"a\"`\n" +
+				"}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := ParseTable(tt.createSQL)
+			if err != nil {
+				t.Fatalf("ParseTable error: %s", err)
+			}
+			got, err := GenStruct("model", table)
+			if err != nil {
+				t.Fatalf("GenStruct error: %s", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GenStruct:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package mdbdiff
+
+import (
+	"strings"
+)
+
+// SplitStatements 按分号拆分多条sql,字符串、标识符和注释中的分号不拆分
+// 支持 mysql 客户端的 DELIMITER 命令,用于触发器和存储过程
+// 返回的语句去掉首尾空白和结尾分隔符,只有注释的语句被忽略
+func SplitStatements(s string) []string {
+	var statements []string
+	var buf strings.Builder
+	isCode := false
+	delimiter := ";"
+	flush := func() {
+		statement := strings.TrimSpace(buf.String())
+		if isCode && len(statement) > 0 {
+			statements = append(statements, statement)
+		}
+		buf.Reset()
+		isCode = false
+	}
+	l := len(s)
+	for i := 0; i < l; i++ {
+		c := s[i]
+		if !isCode && isDelimiterCommand(s[i:]) {
+			// DELIMITER 命令独占一行
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				j = l - i
+			}
+			fields := strings.Fields(s[i : i+j])
+			if len(fields) > 1 {
+				delimiter = fields[1]
+			}
+			buf.Reset()
+			i += j
+			continue
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < l {
+				if s[j] == '\\' && c != '`' {
+					j += 2
+					continue
+				}
+				if s[j] == c {
+					if j+1 < l && s[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= l {
+				j = l - 1
+			}
+			buf.WriteString(s[i : j+1])
+			isCode = true
+			i = j
+		case c == '#' || (c == '-' && i+1 < l && s[i+1] == '-'):
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				j = l - i - 1
+			}
+			buf.WriteString(s[i : i+j+1])
+			i += j
+		case c == '/' && i+1 < l && s[i+1] == '*':
+			j := strings.Index(s[i+2:], "*/")
+			end := l - 1
+			if j >= 0 {
+				end = i + 2 + j + 1
+			}
+			buf.WriteString(s[i : end+1])
+			if i+2 < l && s[i+2] == '!' {
+				// mysql 可执行注释
+				isCode = true
+			}
+			i = end
+		case strings.HasPrefix(s[i:], delimiter):
+			flush()
+			i += len(delimiter) - 1
+		default:
+			buf.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				isCode = true
+			}
+		}
+	}
+	flush()
+	return statements
+}
+
+// isDelimiterCommand 是否 DELIMITER 命令
+func isDelimiterCommand(s string) bool {
+	const command = "DELIMITER"
+	if len(s) <= len(command) || !strings.EqualFold(s[:len(command)], command) {
+		return false
+	}
+	c := s[len(command)]
+	return c == ' ' || c == '\t'
+}
@@ -0,0 +1,69 @@
+package mdbdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{
+			name: "simple",
+			s:    "CREATE TABLE a (id INT);\n\nINSERT INTO a VALUES (1);  ",
+			want: []string{"CREATE TABLE a (id INT)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name: "semicolon in string",
+			s:    `INSERT INTO a VALUES ('x;y', "p\";q", 'it''s;');SELECT 1`,
+			want: []string{`INSERT INTO a VALUES ('x;y', "p\";q", 'it''s;')`, "SELECT 1"},
+		},
+		{
+			name: "semicolon in identifier",
+			s:    "SELECT `a;b` FROM t;",
+			want: []string{"SELECT `a;b` FROM t"},
+		},
+		{
+			name: "semicolon in comment",
+			s:    "SELECT 1 -- a;b\n;\nSELECT 2 # c;d\n;SELECT /* e;f */ 3;",
+			want: []string{"SELECT 1 -- a;b", "SELECT 2 # c;d", "SELECT /* e;f */ 3"},
+		},
+		{
+			name: "comment only",
+			s:    "-- header;\n/* block; */\n;\n# tail\n",
+			want: nil,
+		},
+		{
+			name: "executable comment",
+			s:    "/*!40101 SET NAMES utf8mb4 */;\n/* note */;",
+			want: []string{"/*!40101 SET NAMES utf8mb4 */"},
+		},
+		{
+			name: "delimiter",
+			s: "DELIMITER $$\n" +
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.x = 1; SET NEW.y = 2; END$$\n" +
+				"delimiter ;\n" +
+				"SELECT 1;",
+			want: []string{
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.x = 1; SET NEW.y = 2; END",
+				"SELECT 1",
+			},
+		},
+		{
+			name: "empty",
+			s:    " ;\n; ",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitStatements(tt.s)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
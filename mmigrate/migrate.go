@@ -0,0 +1,633 @@
+package mmigrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/moremorefun/mtool/mdb"
+	"github.com/moremorefun/mtool/mdbdiff"
+	"github.com/moremorefun/mtool/mlog"
+)
+
+// 默认配置
+const (
+	DefaultTable       = "schema_migrations"
+	DefaultLockName    = "schema_migrations"
+	DefaultLockTimeout = 10 * time.Second
+)
+
+// mysqlErrNoSuchTable 表不存在
+const mysqlErrNoSuchTable = 1146
+
+// fileRegexp 迁移文件名 版本_名称.up.sql 版本_名称.down.sql
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration 迁移
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum up 文件的 sha256
+	Checksum string
+}
+
+// Applied 已执行的迁移
+type Applied struct {
+	Version  int64  `db:"version"`
+	Name     string `db:"name"`
+	Checksum string `db:"checksum"`
+	// Dirty 执行中断,迁移可能只执行了一部分,需要手动修复后调用 Force
+	Dirty     bool      `db:"dirty"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Config 迁移配置
+type Config struct {
+	// FS 迁移文件, 目录使用 os.DirFS, 也可以使用 embed.FS
+	FS fs.FS
+	// Dir FS 中的目录,默认 .
+	Dir string
+	// Table 记录表,默认 schema_migrations
+	Table string
+	// LockName GET_LOCK 锁名,默认 schema_migrations
+	LockName string
+	// LockTimeout 获取锁的超时,默认10s
+	LockTimeout time.Duration
+	// DryRun 只输出要执行的sql,不执行也不记录
+	DryRun bool
+	// ScratchSchema 检查漂移时使用的临时数据库,设置后在其中执行所有迁移得到期望的表结构
+	// 同名数据库会被删除重建,检查结束后删除,需要建库权限
+	ScratchSchema string
+	// SchemaFile FS 中执行所有迁移后的表结构文件,没有设置 ScratchSchema 时用于检查漂移
+	// 文件需要和迁移一起维护,可以在执行迁移后用 mdbdiff.DumpSchema 导出
+	SchemaFile string
+}
+
+// Migrator 迁移执行器
+type Migrator struct {
+	db   *sqlx.DB
+	conf Config
+}
+
+// NewMigrator 创建迁移执行器
+func NewMigrator(db *sqlx.DB, conf Config) *Migrator {
+	if len(conf.Dir) == 0 {
+		conf.Dir = "."
+	}
+	if len(conf.Table) == 0 {
+		conf.Table = DefaultTable
+	}
+	if len(conf.LockName) == 0 {
+		conf.LockName = DefaultLockName
+	}
+	if conf.LockTimeout <= 0 {
+		conf.LockTimeout = DefaultLockTimeout
+	}
+	return &Migrator{
+		db:   db,
+		conf: conf,
+	}
+}
+
+// LoadMigrations 读取目录中的迁移文件,按版本排序
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	migrationMap := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := fileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration version error: %s", entry.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := migrationMap[version]
+		if !ok {
+			m = &Migration{
+				Version: version,
+				Name:    matches[2],
+			}
+			migrationMap[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration version duplicate: %d", version)
+		}
+		if matches[3] == "up" {
+			m.Up = string(b)
+			sum := sha256.Sum256(b)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(b)
+		}
+	}
+	migrations := make([]Migration, 0, len(migrationMap))
+	for _, m := range migrationMap {
+		if len(m.Checksum) == 0 {
+			return nil, fmt.Errorf("migration no up file: %d_%s", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrations 读取配置中的迁移文件
+func (m *Migrator) Migrations() ([]Migration, error) {
+	if m.conf.FS == nil {
+		return nil, fmt.Errorf("migration no fs")
+	}
+	return LoadMigrations(m.conf.FS, m.conf.Dir)
+}
+
+// Applied 获取已执行的迁移,按版本排序
+func (m *Migrator) Applied(ctx context.Context) ([]Applied, error) {
+	return m.applied(ctx, m.db)
+}
+
+// applied 获取已执行的迁移,记录表不存在时返回空
+// 旧版本的记录表没有 dirty 列,只读时不升级记录表,所以读取所有列
+func (m *Migrator) applied(ctx context.Context, tx mdb.ExecuteAble) ([]Applied, error) {
+	var applieds []Applied
+	_, err := mdb.ScanContent(
+		ctx,
+		tx,
+		&applieds,
+		`SELECT
+    *
+FROM
+    `+m.conf.Table+`
+ORDER BY
+    version`,
+		gin.H{},
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrNoSuchTable {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return applieds, nil
+}
+
+// ensureTable 创建记录表,旧版本的记录表添加 dirty 列
+func (m *Migrator) ensureTable(ctx context.Context, tx mdb.ExecuteAble) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS `+m.conf.Table+` (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    dirty TINYINT(1) NOT NULL DEFAULT 0,
+    applied_at DATETIME NOT NULL,
+    PRIMARY KEY (version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	)
+	if err != nil {
+		return err
+	}
+	var count int64
+	err = tx.GetContext(
+		ctx,
+		&count,
+		`SELECT
+    COUNT(*)
+FROM
+    information_schema.COLUMNS
+WHERE
+    TABLE_SCHEMA=DATABASE()
+    AND TABLE_NAME=?
+    AND COLUMN_NAME='dirty'`,
+		m.conf.Table,
+	)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`ALTER TABLE `+m.conf.Table+` ADD COLUMN dirty TINYINT(1) NOT NULL DEFAULT 0 AFTER checksum`,
+	)
+	return err
+}
+
+// connDB 单个链接,实现 ExecuteAble
+type connDB struct {
+	*sqlx.Conn
+}
+
+// Get 获取单行
+func (c connDB) Get(dest interface{}, query string, args ...interface{}) error {
+	return c.GetContext(context.Background(), dest, query, args...)
+}
+
+// Exec 执行
+func (c connDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+// Select 获取多行
+func (c connDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.SelectContext(context.Background(), dest, query, args...)
+}
+
+// run 获取锁后执行, dry run 时不加锁也不创建记录表
+func (m *Migrator) run(ctx context.Context, f func(tx mdb.ExecuteAble) error) error {
+	if m.conf.DryRun {
+		return f(m.db)
+	}
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	var isLocked sql.NullInt64
+	err = conn.GetContext(
+		ctx,
+		&isLocked,
+		"SELECT GET_LOCK(?, ?)",
+		m.conf.LockName,
+		int64(m.conf.LockTimeout/time.Second),
+	)
+	if err != nil {
+		return err
+	}
+	if !isLocked.Valid || isLocked.Int64 != 1 {
+		return fmt.Errorf("migration lock timeout: %s", m.conf.LockName)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", m.conf.LockName)
+	}()
+	tx := connDB{Conn: conn}
+	err = m.ensureTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return f(tx)
+}
+
+// execSQL 执行迁移文件中的语句, sql 原样执行,不处理命名参数
+func (m *Migrator) execSQL(ctx context.Context, tx mdb.ExecuteAble, content string) error {
+	for _, statement := range mdbdiff.SplitStatements(content) {
+		if m.conf.DryRun {
+			mlog.Log.Infof("migration dry run:\n%s;", statement)
+			continue
+		}
+		_, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("%w\n%s", err, statement)
+		}
+	}
+	return nil
+}
+
+// checkApplied 检查已执行迁移的校验和
+func checkApplied(migrations []Migration, applieds []Applied) (map[int64]bool, error) {
+	migrationMap := map[int64]Migration{}
+	for _, migration := range migrations {
+		migrationMap[migration.Version] = migration
+	}
+	appliedMap := map[int64]bool{}
+	for _, applied := range applieds {
+		if applied.Dirty {
+			return nil, fmt.Errorf("migration dirty: %d_%s, fix the database then call Force", applied.Version, applied.Name)
+		}
+		appliedMap[applied.Version] = true
+		migration, ok := migrationMap[applied.Version]
+		if !ok {
+			mlog.Log.Warnf("migration applied but no file: %d_%s", applied.Version, applied.Name)
+			continue
+		}
+		if migration.Checksum != applied.Checksum {
+			return nil, fmt.Errorf("migration checksum mismatch: %d_%s", migration.Version, migration.Name)
+		}
+	}
+	return appliedMap, nil
+}
+
+// Up 执行未执行的迁移, steps 小于等于0时全部执行,返回执行的迁移
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = m.run(ctx, func(tx mdb.ExecuteAble) error {
+		applieds, err := m.applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+		appliedMap, err := checkApplied(migrations, applieds)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if appliedMap[migration.Version] {
+				continue
+			}
+			if steps > 0 && len(done) >= steps {
+				break
+			}
+			mlog.Log.Infof("migration up: %d_%s", migration.Version, migration.Name)
+			if !m.conf.DryRun {
+				// 执行前记录为 dirty, DDL 不能回滚,中断后拒绝继续执行
+				_, err = tx.ExecContext(
+					ctx,
+					`INSERT INTO `+m.conf.Table+` (version, name, checksum, dirty, applied_at) VALUES (?, ?, ?, 1, ?)`,
+					migration.Version,
+					migration.Name,
+					migration.Checksum,
+					time.Now(),
+				)
+				if err != nil {
+					return err
+				}
+			}
+			err = m.execSQL(ctx, tx, migration.Up)
+			if err != nil {
+				return fmt.Errorf("migration up %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if !m.conf.DryRun {
+				_, err = tx.ExecContext(
+					ctx,
+					`UPDATE `+m.conf.Table+` SET dirty=0, applied_at=? WHERE version=?`,
+					time.Now(),
+					migration.Version,
+				)
+				if err != nil {
+					return err
+				}
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 回滚已执行的迁移, steps 小于等于0时回滚一个,返回回滚的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	migrationMap := map[int64]Migration{}
+	for _, migration := range migrations {
+		migrationMap[migration.Version] = migration
+	}
+	var done []Migration
+	err = m.run(ctx, func(tx mdb.ExecuteAble) error {
+		applieds, err := m.applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+		_, err = checkApplied(migrations, applieds)
+		if err != nil {
+			return err
+		}
+		for i := len(applieds) - 1; i >= 0 && len(done) < steps; i-- {
+			applied := applieds[i]
+			migration, ok := migrationMap[applied.Version]
+			if !ok {
+				return fmt.Errorf("migration no file: %d_%s", applied.Version, applied.Name)
+			}
+			if len(strings.TrimSpace(migration.Down)) == 0 {
+				return fmt.Errorf("migration no down: %d_%s", migration.Version, migration.Name)
+			}
+			mlog.Log.Infof("migration down: %d_%s", migration.Version, migration.Name)
+			if !m.conf.DryRun {
+				_, err = tx.ExecContext(
+					ctx,
+					`UPDATE `+m.conf.Table+` SET dirty=1 WHERE version=?`,
+					migration.Version,
+				)
+				if err != nil {
+					return err
+				}
+			}
+			err = m.execSQL(ctx, tx, migration.Down)
+			if err != nil {
+				return fmt.Errorf("migration down %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if !m.conf.DryRun {
+				_, err = tx.ExecContext(
+					ctx,
+					`DELETE FROM `+m.conf.Table+` WHERE version=?`,
+					migration.Version,
+				)
+				if err != nil {
+					return err
+				}
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Force 处理中断的迁移,手动修复数据库后调用
+// isApplied 为 true 时标记为已执行,否则删除记录,视为未执行
+func (m *Migrator) Force(ctx context.Context, version int64, isApplied bool) error {
+	if m.conf.DryRun {
+		return fmt.Errorf("migration force not support dry run")
+	}
+	return m.run(ctx, func(tx mdb.ExecuteAble) error {
+		var ret sql.Result
+		var err error
+		if isApplied {
+			ret, err = tx.ExecContext(
+				ctx,
+				`UPDATE `+m.conf.Table+` SET dirty=0 WHERE version=? AND dirty=1`,
+				version,
+			)
+		} else {
+			ret, err = tx.ExecContext(
+				ctx,
+				`DELETE FROM `+m.conf.Table+` WHERE version=? AND dirty=1`,
+				version,
+			)
+		}
+		if err != nil {
+			return err
+		}
+		count, err := ret.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("migration not dirty: %d", version)
+		}
+		mlog.Log.Infof("migration force: %d applied %t", version, isApplied)
+		return nil
+	})
+}
+
+// Drift 检查数据库结构和执行迁移后期望的表结构的差异,返回需要执行的sql,没有差异时返回空字符串
+// 期望的表结构来自 ScratchSchema 中执行的迁移,没有设置时来自 SchemaFile
+// 有未执行的迁移时返回错误
+func (m *Migrator) Drift(ctx context.Context) (string, error) {
+	if len(m.conf.ScratchSchema) == 0 && len(m.conf.SchemaFile) == 0 {
+		return "", fmt.Errorf("migration no scratch schema or schema file")
+	}
+	migrations, err := m.Migrations()
+	if err != nil {
+		return "", err
+	}
+	applieds, err := m.applied(ctx, m.db)
+	if err != nil {
+		return "", err
+	}
+	appliedMap, err := checkApplied(migrations, applieds)
+	if err != nil {
+		return "", err
+	}
+	for _, migration := range migrations {
+		if !appliedMap[migration.Version] {
+			return "", fmt.Errorf("migration pending: %d_%s", migration.Version, migration.Name)
+		}
+	}
+	schema, err := m.expectedSchema(ctx, migrations)
+	if err != nil {
+		return "", err
+	}
+	tableNames, err := m.tableNames(ctx)
+	if err != nil {
+		return "", err
+	}
+	diffSQL, err := mdbdiff.GetDiffSQLString(m.db, tableNames, schema)
+	if err != nil {
+		return "", err
+	}
+	var statements []string
+	for _, statement := range mdbdiff.SplitStatements(diffSQL) {
+		upper := strings.ToUpper(statement)
+		if upper == "BEGIN" ||
+			upper == "COMMIT" ||
+			strings.HasPrefix(upper, "SET FOREIGN_KEY_CHECKS") {
+			continue
+		}
+		statements = append(statements, statement+";")
+	}
+	return strings.Join(statements, "\n"), nil
+}
+
+// expectedSchema 期望的表结构
+func (m *Migrator) expectedSchema(ctx context.Context, migrations []Migration) (string, error) {
+	if len(m.conf.ScratchSchema) == 0 {
+		b, err := fs.ReadFile(m.conf.FS, m.conf.SchemaFile)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	var current sql.NullString
+	err = conn.GetContext(ctx, &current, "SELECT DATABASE()")
+	if err != nil {
+		return "", err
+	}
+	if !current.Valid {
+		return "", fmt.Errorf("migration no database selected")
+	}
+	scratch := quoteName(m.conf.ScratchSchema)
+	if scratch == quoteName(current.String) {
+		return "", fmt.Errorf("migration scratch schema is current database: %s", current.String)
+	}
+	_, err = conn.ExecContext(ctx, "DROP DATABASE IF EXISTS "+scratch)
+	if err != nil {
+		return "", err
+	}
+	_, err = conn.ExecContext(ctx, "CREATE DATABASE "+scratch)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		// 链接放回连接池前切换回原数据库
+		_, _ = conn.ExecContext(context.Background(), "USE "+quoteName(current.String))
+		_, _ = conn.ExecContext(context.Background(), "DROP DATABASE IF EXISTS "+scratch)
+	}()
+	_, err = conn.ExecContext(ctx, "USE "+scratch)
+	if err != nil {
+		return "", err
+	}
+	for _, migration := range migrations {
+		for _, statement := range mdbdiff.SplitStatements(migration.Up) {
+			_, err = conn.ExecContext(ctx, statement)
+			if err != nil {
+				return "", fmt.Errorf("migration scratch %d_%s: %w\n%s", migration.Version, migration.Name, err, statement)
+			}
+		}
+	}
+	return mdbdiff.DumpSchema(ctx, connDB{Conn: conn}, mdbdiff.Filter{})
+}
+
+// quoteName 数据库名加引号
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// tableNames 数据库中除记录表外的表
+func (m *Migrator) tableNames(ctx context.Context) ([]string, error) {
+	rows, err := m.db.QueryContext(ctx, "SHOW TABLES")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var tableNames []string
+	for rows.Next() {
+		var tableName string
+		err = rows.Scan(&tableName)
+		if err != nil {
+			return nil, err
+		}
+		if tableName == m.conf.Table {
+			continue
+		}
+		tableNames = append(tableNames, tableName)
+	}
+	return tableNames, rows.Err()
+}
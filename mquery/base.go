@@ -5,27 +5,41 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 )
 
-var globalIndex int64
-
 // ErrInValueLenZero in 条件数据长度为0
 var ErrInValueLenZero = errors.New("sql in values len 0")
 
 // getK 获取key
-func getK(old string) string {
-	globalIndex++
-	old = strings.ReplaceAll(old, ".", "_")
-	old = strings.ReplaceAll(old, "`", "_")
+// 序号由本次生成sql的参数表决定,同一个语句每次生成的sql相同,并且没有全局状态
+func getK(arg gin.H, old string) string {
 	var buf bytes.Buffer
-	buf.WriteString(old)
+	for _, r := range old {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteRune('_')
+		}
+	}
+	if buf.Len() == 0 {
+		buf.WriteString("p")
+	}
 	buf.WriteString("_")
-	buf.WriteString(strconv.FormatInt(globalIndex, 10))
-	return buf.String()
+	prefix := buf.String()
+	index := len(arg) + 1
+	for {
+		k := prefix + strconv.Itoa(index)
+		if _, ok := arg[k]; !ok {
+			return k
+		}
+		index++
+	}
 }
 
 // ConvertRaw 原样生成
@@ -40,6 +54,113 @@ func (o ConvertRaw) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gi
 	return buf, arg, nil
 }
 
+// identRegexp 可以加引号的标识符, a a.b a.* `a`.b
+var identRegexp = regexp.MustCompile("^(?:[A-Za-z_][A-Za-z0-9_$]*|`[^`]+`|\"[^\"]+\")(?:\\.(?:[A-Za-z_][A-Za-z0-9_$]*|`[^`]+`|\"[^\"]+\"|\\*))?$")
+
+// quoteIdent 按方言给标识符加引号
+// 支持 a, a.b, a alias, a AS alias, a DESC, 表达式等其他写法原样返回
+func quoteIdent(d Dialect, name string) string {
+	fields := strings.Fields(name)
+	switch len(fields) {
+	case 1:
+		if identRegexp.MatchString(fields[0]) {
+			return d.Quote(fields[0])
+		}
+	case 2:
+		order := strings.ToUpper(fields[1])
+		if identRegexp.MatchString(fields[0]) && (order == "ASC" || order == "DESC") {
+			return d.Quote(fields[0]) + " " + order
+		}
+		if identRegexp.MatchString(fields[0]) && identRegexp.MatchString(fields[1]) && !strings.Contains(fields[1], ".") {
+			return d.Quote(fields[0]) + " " + d.Quote(fields[1])
+		}
+	case 3:
+		if identRegexp.MatchString(fields[0]) && strings.EqualFold(fields[1], "AS") && identRegexp.MatchString(fields[2]) && !strings.Contains(fields[2], ".") {
+			return d.Quote(fields[0]) + " AS " + d.Quote(fields[2])
+		}
+	}
+	return name
+}
+
+// quoteIdents 按方言给多个标识符加引号
+func quoteIdents(d Dialect, names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(d, name)
+	}
+	return quoted
+}
+
+// ident 标识符,在构造器中按方言加引号,单独使用时原样生成
+type ident string
+
+// AppendToQuery 写入sql,填充arg
+func (o ident) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	buf.WriteString(string(o))
+	return buf, arg, nil
+}
+
+// dialectAble 按构造器的方言生成的条件,单独使用时列名原样生成
+type dialectAble interface {
+	appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error)
+}
+
+// quoteKey 按方言给条件中的列名加引号,只处理 a 和 a.b,表达式原样返回
+func quoteKey(d Dialect, k string) string {
+	if d == nil || !identRegexp.MatchString(k) {
+		return k
+	}
+	return d.Quote(k)
+}
+
+// withDialect 没有设置方言的子查询和链接使用构造器的方言
+func withDialect(d Dialect, part SQLAble) SQLAble {
+	if d == nil {
+		return part
+	}
+	switch v := part.(type) {
+	case *joinData:
+		if v.dialect == nil {
+			j := *v
+			j.dialect = d
+			return &j
+		}
+	case *selectData:
+		if v.dialect == nil {
+			s := *v
+			s.dialect = d
+			return &s
+		}
+	case *unionData:
+		if v.dialect == nil {
+			u := *v
+			u.dialect = d
+			return &u
+		}
+	}
+	return part
+}
+
+// appendPart 写入构造器中的部分,标识符和条件中的列名按方言加引号,子查询和链接使用构造器的方言
+func appendPart(buf bytes.Buffer, arg gin.H, d Dialect, part SQLAble) (bytes.Buffer, gin.H, error) {
+	if d == nil {
+		return part.AppendToQuery(buf, arg)
+	}
+	switch v := withDialect(d, part).(type) {
+	case ident:
+		buf.WriteString(quoteIdent(d, string(v)))
+		return buf, arg, nil
+	case ConvertDesc:
+		buf.WriteString(quoteIdent(d, string(v)))
+		buf.WriteString(" DESC")
+		return buf, arg, nil
+	case dialectAble:
+		return v.appendDialect(buf, arg, d)
+	default:
+		return v.AppendToQuery(buf, arg)
+	}
+}
+
 // ConvertKv kv结构
 type ConvertKv struct {
 	K string
@@ -59,7 +180,7 @@ type ConvertFuncColAs struct {
 	As   string
 }
 
-// ConvertEq k=:k or k IN (:k)
+// ConvertEq k=:k or k IN (:k) or k IN (subquery)
 type ConvertEq ConvertKv
 
 // ConvertEqMake 生成
@@ -72,9 +193,20 @@ func ConvertEqMake(k string, v interface{}) ConvertEq {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertEq) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
-	k := getK(o.K)
+	return o.appendDialect(buf, arg, nil)
+}
 
-	buf.WriteString(o.K)
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertEq) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	sub, ok := o.V.(SQLAble)
+	if ok {
+		buf.WriteString(quoteKey(d, o.K))
+		buf.WriteString(" IN ")
+		return appendSubQuery(buf, arg, d, sub)
+	}
+	k := getK(arg, o.K)
+
+	buf.WriteString(quoteKey(d, o.K))
 	rt := reflect.TypeOf(o.V)
 	switch rt.Kind() {
 	case reflect.Slice:
@@ -106,9 +238,14 @@ func ConvertAddMake(k string, v interface{}) ConvertAdd {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertAdd) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
-	k := getK(o.K)
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertAdd) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	k := getK(arg, o.K)
 
-	_, err := buf.WriteString(o.K)
+	_, err := buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -116,7 +253,7 @@ func (o ConvertAdd) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gi
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
-	_, err = buf.WriteString(o.K)
+	_, err = buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -145,9 +282,14 @@ func ConvertMinusMake(k string, v interface{}) ConvertMinus {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertMinus) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
-	k := getK(o.K)
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertMinus) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	k := getK(arg, o.K)
 
-	_, err := buf.WriteString(o.K)
+	_, err := buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -155,7 +297,7 @@ func (o ConvertMinus) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer,
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
-	_, err = buf.WriteString(o.K)
+	_, err = buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -184,9 +326,14 @@ func ConvertGtMake(k string, v interface{}) ConvertGt {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertGt) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
-	k := getK(o.K)
+	return o.appendDialect(buf, arg, nil)
+}
 
-	_, err := buf.WriteString(o.K)
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertGt) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	k := getK(arg, o.K)
+
+	_, err := buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -215,9 +362,14 @@ func ConvertLtMake(k string, v interface{}) ConvertLt {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertLt) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
-	k := getK(o.K)
+	return o.appendDialect(buf, arg, nil)
+}
 
-	_, err := buf.WriteString(o.K)
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertLt) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	k := getK(arg, o.K)
+
+	_, err := buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -246,7 +398,12 @@ func ConvertEqRawMake(k, v string) ConvertEqRaw {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertEqRaw) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
-	_, err := buf.WriteString(o.K)
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertEqRaw) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	_, err := buf.WriteString(quoteKey(d, o.K))
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -277,7 +434,7 @@ func (o ConvertDesc) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, g
 	return buf, arg, nil
 }
 
-// ConvertValues k=VALUES(k)
+// ConvertValues k=VALUES(k), 在 insert 的 Duplicates 中按方言生成
 type ConvertValues string
 
 // AppendToQuery 写入sql,填充arg
@@ -317,17 +474,22 @@ func ConvertOrMake(left, right SQLAble) ConvertOr {
 
 // AppendToQuery 写入sql,填充arg
 func (o ConvertOr) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertOr) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
 	var err error
 	if o.Left == nil || o.Right == nil {
 		return bytes.Buffer{}, nil, fmt.Errorf("or empty")
 	}
 	buf.WriteString("(")
-	buf, arg, err = o.Left.AppendToQuery(buf, arg)
+	buf, arg, err = appendPart(buf, arg, d, o.Left)
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
 	buf.WriteString(" or ")
-	buf, arg, err = o.Right.AppendToQuery(buf, arg)
+	buf, arg, err = appendPart(buf, arg, d, o.Right)
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -371,3 +533,428 @@ func (o ConvertFuncAs) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer,
 	}
 	return buf, arg, nil
 }
+
+// ConvertGroup 条件组 (a AND b ...) or (a OR b ...)
+type ConvertGroup struct {
+	Op    string
+	Conds []SQLAble
+}
+
+// And 与条件组,可嵌套
+func And(conds ...SQLAble) ConvertGroup {
+	return ConvertGroup{
+		Op:    "AND",
+		Conds: conds,
+	}
+}
+
+// Or 或条件组,可嵌套
+func Or(conds ...SQLAble) ConvertGroup {
+	return ConvertGroup{
+		Op:    "OR",
+		Conds: conds,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertGroup) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertGroup) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	var err error
+	if len(o.Conds) == 0 {
+		return bytes.Buffer{}, nil, fmt.Errorf("%s empty", strings.ToLower(o.Op))
+	}
+	buf.WriteString("(")
+	for i, cond := range o.Conds {
+		if cond == nil {
+			return bytes.Buffer{}, nil, fmt.Errorf("%s nil cond", strings.ToLower(o.Op))
+		}
+		if i != 0 {
+			buf.WriteString(" ")
+			buf.WriteString(o.Op)
+			buf.WriteString(" ")
+		}
+		buf, arg, err = appendPart(buf, arg, d, cond)
+		if err != nil {
+			return bytes.Buffer{}, nil, err
+		}
+	}
+	buf.WriteString(")")
+	return buf, arg, nil
+}
+
+// ConvertNot NOT (cond)
+type ConvertNot struct {
+	Cond SQLAble
+}
+
+// Not 非条件
+func Not(cond SQLAble) ConvertNot {
+	return ConvertNot{
+		Cond: cond,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertNot) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertNot) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	var err error
+	if o.Cond == nil {
+		return bytes.Buffer{}, nil, fmt.Errorf("not empty")
+	}
+	buf.WriteString("NOT (")
+	buf, arg, err = appendPart(buf, arg, d, o.Cond)
+	if err != nil {
+		return bytes.Buffer{}, nil, err
+	}
+	buf.WriteString(")")
+	return buf, arg, nil
+}
+
+// subQueryAble 可以作为子查询的语句
+type subQueryAble interface {
+	// appendSubQuery 写入不带 As 的语句
+	appendSubQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error)
+}
+
+// appendSubQuery 写入括号中的子查询,忽略子查询的 As
+func appendSubQuery(buf bytes.Buffer, arg gin.H, d Dialect, query SQLAble) (bytes.Buffer, gin.H, error) {
+	var err error
+	query = withDialect(d, query)
+	buf.WriteString("(")
+	sub, ok := query.(subQueryAble)
+	if ok {
+		buf, arg, err = sub.appendSubQuery(buf, arg)
+	} else {
+		buf, arg, err = query.AppendToQuery(buf, arg)
+	}
+	if err != nil {
+		return bytes.Buffer{}, nil, err
+	}
+	buf.WriteString(")")
+	return buf, arg, nil
+}
+
+// appendValue 写入值,子查询加括号写入,其他值生成参数
+func appendValue(buf bytes.Buffer, arg gin.H, d Dialect, key string, v interface{}) (bytes.Buffer, gin.H, error) {
+	sub, ok := v.(SQLAble)
+	if ok {
+		return appendSubQuery(buf, arg, d, sub)
+	}
+	k := getK(arg, key)
+	buf.WriteString(":")
+	buf.WriteString(k)
+	arg[k] = v
+	return buf, arg, nil
+}
+
+// appendCompare 写入 k op :k
+func appendCompare(buf bytes.Buffer, arg gin.H, d Dialect, key, op string, v interface{}) (bytes.Buffer, gin.H, error) {
+	buf.WriteString(quoteKey(d, key))
+	buf.WriteString(op)
+	return appendValue(buf, arg, d, key, v)
+}
+
+// ConvertGte k>=:k
+type ConvertGte ConvertKv
+
+// ConvertGteMake 生成
+func ConvertGteMake(k string, v interface{}) ConvertGte {
+	return ConvertGte{
+		K: k,
+		V: v,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertGte) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertGte) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	return appendCompare(buf, arg, d, o.K, ">=", o.V)
+}
+
+// ConvertLte k<=:k
+type ConvertLte ConvertKv
+
+// ConvertLteMake 生成
+func ConvertLteMake(k string, v interface{}) ConvertLte {
+	return ConvertLte{
+		K: k,
+		V: v,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertLte) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertLte) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	return appendCompare(buf, arg, d, o.K, "<=", o.V)
+}
+
+// ConvertNe k!=:k
+type ConvertNe ConvertKv
+
+// ConvertNeMake 生成
+func ConvertNeMake(k string, v interface{}) ConvertNe {
+	return ConvertNe{
+		K: k,
+		V: v,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertNe) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertNe) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	return appendCompare(buf, arg, d, o.K, "!=", o.V)
+}
+
+// ConvertRegexp k REGEXP :k
+type ConvertRegexp ConvertKv
+
+// ConvertRegexpMake 生成
+func ConvertRegexpMake(k string, v interface{}) ConvertRegexp {
+	return ConvertRegexp{
+		K: k,
+		V: v,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertRegexp) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertRegexp) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	return appendCompare(buf, arg, d, o.K, " REGEXP ", o.V)
+}
+
+// ConvertNotIn k NOT IN (:k)
+type ConvertNotIn ConvertKv
+
+// ConvertNotInMake 生成
+func ConvertNotInMake(k string, v interface{}) ConvertNotIn {
+	return ConvertNotIn{
+		K: k,
+		V: v,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertNotIn) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertNotIn) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	_, ok := o.V.(SQLAble)
+	if ok {
+		return appendCompare(buf, arg, d, o.K, " NOT IN ", o.V)
+	}
+	rv := reflect.ValueOf(o.V)
+	if rv.Kind() != reflect.Slice {
+		return bytes.Buffer{}, nil, fmt.Errorf("not in value must be slice: %s", o.K)
+	}
+	if rv.Len() == 0 {
+		// 不在空集合中,恒为真
+		buf.WriteString("1=1")
+		return buf, arg, nil
+	}
+	k := getK(arg, o.K)
+	buf.WriteString(quoteKey(d, o.K))
+	buf.WriteString(" NOT IN (:")
+	buf.WriteString(k)
+	buf.WriteString(")")
+	arg[k] = o.V
+	return buf, arg, nil
+}
+
+// like 匹配方式
+const (
+	LikeContains = 1
+	LikePrefix   = 2
+	LikeSuffix   = 3
+)
+
+// likeReplacer like 特殊字符转义
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ConvertLike k LIKE :k ESCAPE '\',值中的 % _ \ 会被转义
+type ConvertLike struct {
+	K    string
+	V    string
+	Mode int64
+}
+
+// ConvertLikeMake 生成 包含
+func ConvertLikeMake(k, v string) ConvertLike {
+	return ConvertLike{
+		K:    k,
+		V:    v,
+		Mode: LikeContains,
+	}
+}
+
+// ConvertLikePrefixMake 生成 前缀
+func ConvertLikePrefixMake(k, v string) ConvertLike {
+	return ConvertLike{
+		K:    k,
+		V:    v,
+		Mode: LikePrefix,
+	}
+}
+
+// ConvertLikeSuffixMake 生成 后缀
+func ConvertLikeSuffixMake(k, v string) ConvertLike {
+	return ConvertLike{
+		K:    k,
+		V:    v,
+		Mode: LikeSuffix,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertLike) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertLike) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	v := likeReplacer.Replace(o.V)
+	switch o.Mode {
+	case LikeContains:
+		v = "%" + v + "%"
+	case LikePrefix:
+		v = v + "%"
+	case LikeSuffix:
+		v = "%" + v
+	default:
+		return bytes.Buffer{}, nil, fmt.Errorf("no like mode: %d", o.Mode)
+	}
+	var err error
+	buf, arg, err = appendCompare(buf, arg, d, o.K, " LIKE ", v)
+	if err != nil {
+		return bytes.Buffer{}, nil, err
+	}
+	if d == nil {
+		d = defaultDialect
+	}
+	buf.WriteString(" ")
+	buf.WriteString(d.LikeEscapeSQL())
+	return buf, arg, nil
+}
+
+// ConvertBetween k BETWEEN :k1 AND :k2
+type ConvertBetween struct {
+	K     string
+	Start interface{}
+	End   interface{}
+}
+
+// ConvertBetweenMake 生成
+func ConvertBetweenMake(k string, start, end interface{}) ConvertBetween {
+	return ConvertBetween{
+		K:     k,
+		Start: start,
+		End:   end,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertBetween) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertBetween) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	var err error
+	buf, arg, err = appendCompare(buf, arg, d, o.K, " BETWEEN ", o.Start)
+	if err != nil {
+		return bytes.Buffer{}, nil, err
+	}
+	buf.WriteString(" AND ")
+	return appendValue(buf, arg, d, o.K, o.End)
+}
+
+// ConvertIsNull k IS NULL
+type ConvertIsNull string
+
+// ConvertIsNullMake 生成
+func ConvertIsNullMake(k string) ConvertIsNull {
+	return ConvertIsNull(k)
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertIsNull) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertIsNull) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	buf.WriteString(quoteKey(d, string(o)))
+	buf.WriteString(" IS NULL")
+	return buf, arg, nil
+}
+
+// ConvertIsNotNull k IS NOT NULL
+type ConvertIsNotNull string
+
+// ConvertIsNotNullMake 生成
+func ConvertIsNotNullMake(k string) ConvertIsNotNull {
+	return ConvertIsNotNull(k)
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertIsNotNull) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertIsNotNull) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	buf.WriteString(quoteKey(d, string(o)))
+	buf.WriteString(" IS NOT NULL")
+	return buf, arg, nil
+}
+
+// ConvertExists EXISTS (subquery)
+type ConvertExists struct {
+	Query SQLAble
+}
+
+// ConvertExistsMake 生成,子查询的As会被忽略
+func ConvertExistsMake(query SQLAble) ConvertExists {
+	return ConvertExists{
+		Query: query,
+	}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o ConvertExists) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o ConvertExists) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	if o.Query == nil {
+		return bytes.Buffer{}, nil, fmt.Errorf("exists empty")
+	}
+	buf.WriteString("EXISTS ")
+	return appendSubQuery(buf, arg, d, o.Query)
+}
@@ -0,0 +1,102 @@
+package mquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// ErrStopIteration 在迭代回调中返回,提前结束迭代且不返回错误
+var ErrStopIteration = errors.New("stop iteration")
+
+// Cursor 获取游标,逐行读取数据
+func (q *selectData) Cursor(ctx context.Context, tx mdb.ExecuteAble) (*mdb.Cursor, error) {
+	query, arg, err := q.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	return mdb.CursorContent(ctx, tx, query, arg)
+}
+
+// DoEach 逐行读取数据,回调返回错误时停止并关闭游标
+func (q *selectData) DoEach(ctx context.Context, tx mdb.ExecuteAble, f func(c *mdb.Cursor) error) error {
+	c, err := q.Cursor(ctx, tx)
+	if err == ErrInValueLenZero {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+	for c.Next() {
+		err = f(c)
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return c.Err()
+}
+
+// clone 复制
+func (q *selectData) clone() *selectData {
+	c := *q
+	c.columns = append([]SQLAble{}, q.columns...)
+	c.joins = append([]SQLAble{}, q.joins...)
+	c.whereParts = append([]SQLAble{}, q.whereParts...)
+	c.groupBys = append([]SQLAble{}, q.groupBys...)
+	c.orderByParts = append([]SQLAble{}, q.orderByParts...)
+	return &c
+}
+
+// DoKeyset 按主键顺序分页遍历,不使用 OFFSET
+// key 为单列唯一键,每页 pageSize 行,查询中的排序和分页会被替换
+func (q *selectData) DoKeyset(ctx context.Context, tx mdb.ExecuteAble, key string, pageSize int64, f func(rows []gin.H) error) error {
+	if pageSize <= 0 {
+		return fmt.Errorf("keyset page size must > 0")
+	}
+	mapKey := FormatMapKey(key)
+	var last interface{}
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		page := q.clone()
+		page.orderByParts = []SQLAble{ConvertRaw(key)}
+		page.offset = 0
+		page.limit = pageSize
+		if last != nil {
+			page.whereParts = append(page.whereParts, ConvertGtMake(key, last))
+		}
+		rows, err := page.Rows(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		err = f(rows)
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if int64(len(rows)) < pageSize {
+			return nil
+		}
+		v, ok := rows[len(rows)-1][mapKey]
+		if !ok || v == nil {
+			return fmt.Errorf("no keyset key: %s", mapKey)
+		}
+		last = v
+	}
+}
@@ -4,14 +4,23 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/moremorefun/mtool/mdb"
 )
 
 type deleteData struct {
-	table      string
-	whereParts []SQLAble
+	table        string
+	targets      []string
+	joins        []SQLAble
+	whereParts   []SQLAble
+	orderByParts []SQLAble
+	limit        int64
+	dialect      Dialect
+	model        *Model
+	isUnscoped   bool
 }
 
 // Delete 创建删除
@@ -32,17 +41,111 @@ func (q *deleteData) Where(whereParts ...SQLAble) *deleteData {
 	return q
 }
 
+// Targets 多表删除时要删除的表,默认为主表的别名或表名
+func (q *deleteData) Targets(targets ...string) *deleteData {
+	q.targets = append(q.targets, targets...)
+	return q
+}
+
+// Join 链接,多表删除时不能使用排序和限制
+func (q *deleteData) Join(join ...SQLAble) *deleteData {
+	q.joins = append(q.joins, join...)
+	return q
+}
+
+// OrderBys 排序
+func (q *deleteData) OrderBys(orders ...SQLAble) *deleteData {
+	q.orderByParts = append(q.orderByParts, orders...)
+	return q
+}
+
+// OrderBysString 排序
+func (q *deleteData) OrderBysString(orders ...string) *deleteData {
+	for _, order := range orders {
+		q.orderByParts = append(q.orderByParts, ident(order))
+	}
+	return q
+}
+
+// Limit 限制
+func (q *deleteData) Limit(limit int64) *deleteData {
+	q.limit = limit
+	return q
+}
+
+// Dialect 设置方言,默认使用 SetDefaultDialect 设置的方言
+func (q *deleteData) Dialect(d Dialect) *deleteData {
+	q.dialect = d
+	return q
+}
+
+// getDialect 获取方言
+func (q *deleteData) getDialect() Dialect {
+	if q.dialect == nil {
+		return defaultDialect
+	}
+	return q.dialect
+}
+
+// getTargets 获取多表删除的表, "table t" 和 "table AS t" 取别名 t
+func (q *deleteData) getTargets() []string {
+	if len(q.targets) > 0 {
+		return q.targets
+	}
+	return []string{tableAlias(q.table)}
+}
+
+// Unscoped 通过模型创建时执行真实删除
+func (q *deleteData) Unscoped() *deleteData {
+	q.isUnscoped = true
+	return q
+}
+
+// softDeleteSQL 软删除转为更新删除时间
+func (q *deleteData) softDeleteSQL() (string, gin.H, error) {
+	col := q.model.conf.DeletedAt
+	if len(q.joins) > 0 {
+		col = tableAlias(q.table) + "." + col
+	}
+	u := Update().
+		Table(q.table).
+		Join(q.joins...).
+		Update(ConvertEqMake(col, q.model.conf.NowFunc())).
+		Where(q.whereParts...).
+		OrderBys(q.orderByParts...).
+		Limit(q.limit).
+		Dialect(q.dialect)
+	u.model = q.model
+	return u.ToSQL()
+}
+
 // ToSQL 生成sql
 func (q *deleteData) ToSQL() (string, gin.H, error) {
 	var err error
 	var buf bytes.Buffer
 	arg := gin.H{}
 
-	buf.WriteString("DELETE\nFROM\n    ")
-	if len(q.table) == 0 {
+	if q.model != nil && q.model.isSoftDelete() && !q.isUnscoped {
+		return q.softDeleteSQL()
+	}
+	if len(strings.TrimSpace(q.table)) == 0 {
 		return "", nil, fmt.Errorf("delete no table")
 	}
-	buf.WriteString(q.table)
+	if len(q.joins) > 0 && (len(q.orderByParts) > 0 || q.limit > 0) {
+		return "", nil, fmt.Errorf("multi-table delete not support order by or limit")
+	}
+	d := q.getDialect()
+	buf.WriteString("DELETE")
+	if len(q.joins) > 0 {
+		buf.WriteString("\n    ")
+		buf.WriteString(strings.Join(quoteIdents(d, q.getTargets()), ", "))
+	}
+	buf.WriteString("\nFROM\n    ")
+	buf.WriteString(quoteIdent(d, q.table))
+	buf, arg, err = appendJoins(buf, arg, d, q.joins)
+	if err != nil {
+		return "", nil, err
+	}
 	if len(q.whereParts) > 0 {
 		buf.WriteString("\nWHERE")
 		for i, where := range q.whereParts {
@@ -50,12 +153,16 @@ func (q *deleteData) ToSQL() (string, gin.H, error) {
 			if i != 0 {
 				buf.WriteString("AND ")
 			}
-			buf, arg, err = where.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, where)
 			if err != nil {
 				return "", nil, err
 			}
 		}
 	}
+	buf, arg, err = appendOrderLimit(buf, arg, d, q.orderByParts, q.limit)
+	if err != nil {
+		return "", nil, err
+	}
 	return buf.String(), arg, nil
 }
 
@@ -72,3 +179,40 @@ func (q *deleteData) DoExecuteCount(ctx context.Context, tx mdb.ExecuteAble) (in
 		arg,
 	)
 }
+
+// DoExecuteCountLoop 按 Limit 分批循环删除,直到影响行数为0,返回总行数
+// interval 为每批之间的间隔,用于降低对主库和复制的压力
+func (q *deleteData) DoExecuteCountLoop(ctx context.Context, tx mdb.ExecuteAble, interval time.Duration) (int64, error) {
+	if q.limit <= 0 {
+		return 0, fmt.Errorf("delete loop no limit")
+	}
+	query, arg, err := q.ToSQL()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for {
+		count, err := mdb.ExecuteCountContent(
+			ctx,
+			tx,
+			query,
+			arg,
+		)
+		if err != nil {
+			return total, err
+		}
+		total += count
+		if count == 0 {
+			return total, nil
+		}
+		if interval > 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(interval):
+			}
+		} else if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package mquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect sql方言
+type Dialect interface {
+	// Name 名称
+	Name() string
+	// Quote 标识符加引号, a.b 会分别处理
+	Quote(name string) string
+	// LimitSQL 分页语句
+	LimitSQL(limit, offset int64) string
+	// LockSQL 加锁语句
+	LockSQL(isSkipLocked bool) (string, error)
+	// InsertSQL insert 开头
+	InsertSQL(isIgnore bool) string
+	// UpsertSQL 冲突处理开头, isUpdate 为 false 时只处理 ignore
+	UpsertSQL(isIgnore bool, conflictColumns []string, isUpdate bool) (string, error)
+	// UpsertValue 冲突时使用插入的值 col=新值
+	UpsertValue(col string) string
+	// IsSupportReturning 是否支持 RETURNING
+	IsSupportReturning() bool
+	// IsSupportUpdateJoinLimit UPDATE DELETE 是否支持 JOIN ORDER BY LIMIT
+	IsSupportUpdateJoinLimit() bool
+	// LikeEscapeSQL LIKE 使用反斜杠转义的 ESCAPE 语句
+	LikeEscapeSQL() string
+	// IsSupportUnionParens UNION 的子查询是否可以加括号
+	IsSupportUnionParens() bool
+	// InsertIDRange 多行插入后由 LastInsertId 得到id范围,不支持时返回0
+	InsertIDRange(lastID, affected int64) (int64, int64)
+}
+
+// 内置方言
+var (
+	DialectMySQL    Dialect = dialectMySQL{}
+	DialectPostgres Dialect = dialectPostgres{}
+	DialectSQLite   Dialect = dialectSQLite{}
+)
+
+// defaultDialect 默认方言
+var defaultDialect = DialectMySQL
+
+// SetDefaultDialect 设置默认方言,在程序启动时设置
+func SetDefaultDialect(d Dialect) {
+	defaultDialect = d
+}
+
+// GetDefaultDialect 获取默认方言
+func GetDefaultDialect() Dialect {
+	return defaultDialect
+}
+
+// quoteWith 使用引号包装标识符
+func quoteWith(name, quote string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part == "*" {
+			continue
+		}
+		part = strings.Trim(part, "`\"")
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// limitOffsetSQL LIMIT l OFFSET o
+func limitOffsetSQL(limit, offset int64) string {
+	if limit <= 0 {
+		return ""
+	}
+	if offset > 0 {
+		return "LIMIT " + strconv.FormatInt(limit, 10) + " OFFSET " + strconv.FormatInt(offset, 10)
+	}
+	return "LIMIT " + strconv.FormatInt(limit, 10)
+}
+
+// onConflictSQL ON CONFLICT (cols) DO ...
+func onConflictSQL(isIgnore bool, conflictColumns []string, isUpdate bool) (string, error) {
+	if isUpdate {
+		if len(conflictColumns) == 0 {
+			return "", fmt.Errorf("upsert no conflict columns")
+		}
+		return "ON CONFLICT (" + strings.Join(conflictColumns, ", ") + ") DO UPDATE SET", nil
+	}
+	if !isIgnore {
+		return "", nil
+	}
+	if len(conflictColumns) == 0 {
+		return "ON CONFLICT DO NOTHING", nil
+	}
+	return "ON CONFLICT (" + strings.Join(conflictColumns, ", ") + ") DO NOTHING", nil
+}
+
+type dialectMySQL struct{}
+
+// Name 名称
+func (dialectMySQL) Name() string {
+	return "mysql"
+}
+
+// Quote 标识符加引号
+func (dialectMySQL) Quote(name string) string {
+	return quoteWith(name, "`")
+}
+
+// LimitSQL LIMIT o, l
+func (dialectMySQL) LimitSQL(limit, offset int64) string {
+	if limit <= 0 {
+		return ""
+	}
+	if offset > 0 {
+		return "LIMIT " + strconv.FormatInt(offset, 10) + ", " + strconv.FormatInt(limit, 10)
+	}
+	return "LIMIT " + strconv.FormatInt(limit, 10)
+}
+
+// LockSQL FOR UPDATE [SKIP LOCKED]
+func (dialectMySQL) LockSQL(isSkipLocked bool) (string, error) {
+	if isSkipLocked {
+		return "FOR UPDATE SKIP LOCKED", nil
+	}
+	return "FOR UPDATE", nil
+}
+
+// InsertSQL INSERT [IGNORE] INTO
+func (dialectMySQL) InsertSQL(isIgnore bool) string {
+	if isIgnore {
+		return "INSERT IGNORE INTO"
+	}
+	return "INSERT INTO"
+}
+
+// UpsertSQL ON DUPLICATE KEY UPDATE
+func (dialectMySQL) UpsertSQL(isIgnore bool, conflictColumns []string, isUpdate bool) (string, error) {
+	if isUpdate {
+		return "ON DUPLICATE KEY UPDATE", nil
+	}
+	return "", nil
+}
+
+// UpsertValue col=VALUES(col)
+func (dialectMySQL) UpsertValue(col string) string {
+	return col + "=VALUES(" + col + ")"
+}
+
+// IsSupportReturning 不支持
+func (dialectMySQL) IsSupportReturning() bool {
+	return false
+}
+
+// IsSupportUpdateJoinLimit 支持
+func (dialectMySQL) IsSupportUpdateJoinLimit() bool {
+	return true
+}
+
+// LikeEscapeSQL 字符串中反斜杠需要转义
+func (dialectMySQL) LikeEscapeSQL() string {
+	return `ESCAPE '\\'`
+}
+
+// IsSupportUnionParens 支持
+func (dialectMySQL) IsSupportUnionParens() bool {
+	return true
+}
+
+// InsertIDRange 返回本批第一个id
+func (dialectMySQL) InsertIDRange(lastID, affected int64) (int64, int64) {
+	return lastID, lastID + affected - 1
+}
+
+type dialectPostgres struct{}
+
+// Name 名称
+func (dialectPostgres) Name() string {
+	return "postgres"
+}
+
+// Quote 标识符加引号
+func (dialectPostgres) Quote(name string) string {
+	return quoteWith(name, `"`)
+}
+
+// LimitSQL LIMIT l OFFSET o
+func (dialectPostgres) LimitSQL(limit, offset int64) string {
+	return limitOffsetSQL(limit, offset)
+}
+
+// LockSQL FOR UPDATE [SKIP LOCKED]
+func (dialectPostgres) LockSQL(isSkipLocked bool) (string, error) {
+	if isSkipLocked {
+		return "FOR UPDATE SKIP LOCKED", nil
+	}
+	return "FOR UPDATE", nil
+}
+
+// InsertSQL INSERT INTO, ignore 使用 ON CONFLICT DO NOTHING
+func (dialectPostgres) InsertSQL(isIgnore bool) string {
+	return "INSERT INTO"
+}
+
+// UpsertSQL ON CONFLICT
+func (dialectPostgres) UpsertSQL(isIgnore bool, conflictColumns []string, isUpdate bool) (string, error) {
+	return onConflictSQL(isIgnore, conflictColumns, isUpdate)
+}
+
+// UpsertValue col=EXCLUDED.col
+func (dialectPostgres) UpsertValue(col string) string {
+	return col + "=EXCLUDED." + col
+}
+
+// IsSupportReturning 支持
+func (dialectPostgres) IsSupportReturning() bool {
+	return true
+}
+
+// IsSupportUpdateJoinLimit 不支持
+func (dialectPostgres) IsSupportUpdateJoinLimit() bool {
+	return false
+}
+
+// LikeEscapeSQL ESCAPE '\'
+func (dialectPostgres) LikeEscapeSQL() string {
+	return `ESCAPE '\'`
+}
+
+// IsSupportUnionParens 支持
+func (dialectPostgres) IsSupportUnionParens() bool {
+	return true
+}
+
+// InsertIDRange 不支持 LastInsertId,使用 RETURNING
+func (dialectPostgres) InsertIDRange(lastID, affected int64) (int64, int64) {
+	return 0, 0
+}
+
+type dialectSQLite struct{}
+
+// Name 名称
+func (dialectSQLite) Name() string {
+	return "sqlite"
+}
+
+// Quote 标识符加引号
+func (dialectSQLite) Quote(name string) string {
+	return quoteWith(name, `"`)
+}
+
+// LimitSQL LIMIT l OFFSET o
+func (dialectSQLite) LimitSQL(limit, offset int64) string {
+	return limitOffsetSQL(limit, offset)
+}
+
+// LockSQL sqlite 不支持行锁
+func (dialectSQLite) LockSQL(isSkipLocked bool) (string, error) {
+	return "", fmt.Errorf("sqlite not support for update")
+}
+
+// InsertSQL INSERT [OR IGNORE] INTO
+func (dialectSQLite) InsertSQL(isIgnore bool) string {
+	if isIgnore {
+		return "INSERT OR IGNORE INTO"
+	}
+	return "INSERT INTO"
+}
+
+// UpsertSQL ON CONFLICT, ignore 已在开头处理
+func (dialectSQLite) UpsertSQL(isIgnore bool, conflictColumns []string, isUpdate bool) (string, error) {
+	return onConflictSQL(false, conflictColumns, isUpdate)
+}
+
+// UpsertValue col=excluded.col
+func (dialectSQLite) UpsertValue(col string) string {
+	return col + "=excluded." + col
+}
+
+// IsSupportReturning sqlite 3.35 之后支持
+func (dialectSQLite) IsSupportReturning() bool {
+	return true
+}
+
+// IsSupportUpdateJoinLimit 不支持
+func (dialectSQLite) IsSupportUpdateJoinLimit() bool {
+	return false
+}
+
+// LikeEscapeSQL ESCAPE '\'
+func (dialectSQLite) LikeEscapeSQL() string {
+	return `ESCAPE '\'`
+}
+
+// IsSupportUnionParens 不支持
+func (dialectSQLite) IsSupportUnionParens() bool {
+	return false
+}
+
+// InsertIDRange 返回本批最后一个id
+func (dialectSQLite) InsertIDRange(lastID, affected int64) (int64, int64) {
+	return lastID - affected + 1, lastID
+}
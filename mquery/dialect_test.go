@@ -0,0 +1,369 @@
+package mquery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toSQLAble 可以生成sql的构造器
+type toSQLAble interface {
+	ToSQL() (string, gin.H, error)
+}
+
+// backtick 把期望结果中的双引号换成 mysql 的反引号
+func backtick(s string) string {
+	return strings.ReplaceAll(s, `"`, "`")
+}
+
+func TestToSQLDialect(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(d Dialect) toSQLAble
+		arg   gin.H
+		want  map[string]string
+	}{
+		{
+			name: "select",
+			build: func(d Dialect) toSQLAble {
+				return Select().
+					Dialect(d).
+					ColumnsString("id", "u.name AS n").
+					FromString("user u").
+					Where(
+						ConvertEqMake("u.id", []int64{1, 2}),
+						ConvertLikePrefixMake("name", "a%"),
+						ConvertRaw("LOWER(x)=1"),
+					).
+					OrderBysString("id DESC").
+					Limit(10).
+					Offset(20)
+			},
+			arg: gin.H{
+				"u_id_1": []int64{1, 2},
+				"name_2": `a\%%`,
+			},
+			want: map[string]string{
+				"mysql": backtick(`SELECT
+    "id",
+    "u"."name" AS "n"
+FROM
+    "user" "u"
+WHERE
+    "u"."id" IN (:u_id_1)
+    AND "name" LIKE :name_2 ESCAPE '\\'
+    AND LOWER(x)=1
+ORDER BY
+    "id" DESC
+LIMIT 20, 10`),
+				"postgres": `SELECT
+    "id",
+    "u"."name" AS "n"
+FROM
+    "user" "u"
+WHERE
+    "u"."id" IN (:u_id_1)
+    AND "name" LIKE :name_2 ESCAPE '\'
+    AND LOWER(x)=1
+ORDER BY
+    "id" DESC
+LIMIT 10 OFFSET 20`,
+				"sqlite": `SELECT
+    "id",
+    "u"."name" AS "n"
+FROM
+    "user" "u"
+WHERE
+    "u"."id" IN (:u_id_1)
+    AND "name" LIKE :name_2 ESCAPE '\'
+    AND LOWER(x)=1
+ORDER BY
+    "id" DESC
+LIMIT 10 OFFSET 20`,
+			},
+		},
+		{
+			name: "upsert",
+			build: func(d Dialect) toSQLAble {
+				return Insert().
+					Dialect(d).
+					Into("user").
+					Columns("id", "name").
+					Values([]interface{}{1, "a"}).
+					OnConflict("id").
+					Duplicates(ConvertValues("name"))
+			},
+			arg: gin.H{
+				"value0": []interface{}{1, "a"},
+			},
+			want: map[string]string{
+				"mysql": backtick(`INSERT INTO "user" (
+    "id",
+    "name"
+) VALUES
+(:value0)
+ON DUPLICATE KEY UPDATE
+    "name"=VALUES("name")`),
+				"postgres": `INSERT INTO "user" (
+    "id",
+    "name"
+) VALUES
+(:value0)
+ON CONFLICT ("id") DO UPDATE SET
+    "name"=EXCLUDED."name"`,
+				"sqlite": `INSERT INTO "user" (
+    "id",
+    "name"
+) VALUES
+(:value0)
+ON CONFLICT ("id") DO UPDATE SET
+    "name"=excluded."name"`,
+			},
+		},
+		{
+			name: "update",
+			build: func(d Dialect) toSQLAble {
+				return Update().
+					Dialect(d).
+					Table("user").
+					Update(ConvertAddMake("count", 1), ConvertEqMake("name", "b")).
+					Where(ConvertEqMake("id", 1))
+			},
+			arg: gin.H{
+				"count_1": 1,
+				"name_2":  "b",
+				"id_3":    1,
+			},
+			want: map[string]string{
+				"mysql": backtick(`UPDATE
+    "user"
+SET
+    "count"="count"+:count_1,
+    "name"=:name_2
+WHERE
+    "id"=:id_3`),
+				"postgres": `UPDATE
+    "user"
+SET
+    "count"="count"+:count_1,
+    "name"=:name_2
+WHERE
+    "id"=:id_3`,
+				"sqlite": `UPDATE
+    "user"
+SET
+    "count"="count"+:count_1,
+    "name"=:name_2
+WHERE
+    "id"=:id_3`,
+			},
+		},
+		{
+			name: "delete",
+			build: func(d Dialect) toSQLAble {
+				return Delete().
+					Dialect(d).
+					Table("user").
+					Where(ConvertIsNullMake("deleted_at"))
+			},
+			arg: gin.H{},
+			want: map[string]string{
+				"mysql": backtick(`DELETE
+FROM
+    "user"
+WHERE
+    "deleted_at" IS NULL`),
+				"postgres": `DELETE
+FROM
+    "user"
+WHERE
+    "deleted_at" IS NULL`,
+				"sqlite": `DELETE
+FROM
+    "user"
+WHERE
+    "deleted_at" IS NULL`,
+			},
+		},
+		{
+			name: "union",
+			build: func(d Dialect) toSQLAble {
+				return Union(
+					Select().ColumnsString("id").FromString("a").OrderBysString("id").Limit(1).As("x"),
+					Select().ColumnsString("id").FromString("b"),
+				).Dialect(d)
+			},
+			arg: gin.H{},
+			want: map[string]string{
+				"mysql": backtick(`(
+SELECT
+    "id"
+FROM
+    "a"
+ORDER BY
+    "id"
+LIMIT 1
+)
+UNION
+SELECT
+    "id"
+FROM
+    "b"`),
+				"postgres": `(
+SELECT
+    "id"
+FROM
+    "a"
+ORDER BY
+    "id"
+LIMIT 1
+)
+UNION
+SELECT
+    "id"
+FROM
+    "b"`,
+				"sqlite": `SELECT * FROM (
+SELECT
+    "id"
+FROM
+    "a"
+ORDER BY
+    "id"
+LIMIT 1
+)
+UNION
+SELECT
+    "id"
+FROM
+    "b"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, d := range []Dialect{DialectMySQL, DialectPostgres, DialectSQLite} {
+			t.Run(tt.name+"/"+d.Name(), func(t *testing.T) {
+				query, arg, err := tt.build(d).ToSQL()
+				if err != nil {
+					t.Fatalf("ToSQL error: %s", err)
+				}
+				if query != tt.want[d.Name()] {
+					t.Errorf("ToSQL sql:\n%s\nwant:\n%s", query, tt.want[d.Name()])
+				}
+				if !reflect.DeepEqual(arg, tt.arg) {
+					t.Errorf("ToSQL arg: %v, want %v", arg, tt.arg)
+				}
+			})
+		}
+	}
+}
+
+func TestConvertAppendToQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		cond SQLAble
+		sql  string
+		arg  gin.H
+		err  error
+	}{
+		{
+			name: "eq",
+			cond: ConvertEqMake("a.id", 1),
+			sql:  "a.id=:a_id_1",
+			arg:  gin.H{"a_id_1": 1},
+		},
+		{
+			name: "eq slice",
+			cond: ConvertEqMake("id", []int64{1, 2}),
+			sql:  "id IN (:id_1)",
+			arg:  gin.H{"id_1": []int64{1, 2}},
+		},
+		{
+			name: "eq empty slice",
+			cond: ConvertEqMake("id", []int64{}),
+			err:  ErrInValueLenZero,
+		},
+		{
+			name: "eq subquery ignores as",
+			cond: ConvertEqMake("uid", Select().ColumnsString("id").FromString("u").As("x")),
+			sql:  "uid IN (SELECT\n    `id`\nFROM\n    `u`)",
+			arg:  gin.H{},
+		},
+		{
+			name: "not in empty",
+			cond: ConvertNotInMake("id", []int64{}),
+			sql:  "1=1",
+			arg:  gin.H{},
+		},
+		{
+			name: "like contains",
+			cond: ConvertLikeMake("name", `a_b\c`),
+			sql:  `name LIKE :name_1 ESCAPE '\\'`,
+			arg:  gin.H{"name_1": `%a\_b\\c%`},
+		},
+		{
+			name: "like suffix",
+			cond: ConvertLikeSuffixMake("name", "100%"),
+			sql:  `name LIKE :name_1 ESCAPE '\\'`,
+			arg:  gin.H{"name_1": `%100\%`},
+		},
+		{
+			name: "between",
+			cond: ConvertBetweenMake("age", 1, 9),
+			sql:  "age BETWEEN :age_1 AND :age_2",
+			arg:  gin.H{"age_1": 1, "age_2": 9},
+		},
+		{
+			name: "group",
+			cond: And(ConvertGtMake("a", 1), Or(ConvertIsNullMake("b"), Not(ConvertEqRawMake("c", "d")))),
+			sql:  "(a>:a_1 AND (b IS NULL OR NOT (c=d)))",
+			arg:  gin.H{"a_1": 1},
+		},
+		{
+			name: "exists",
+			cond: ConvertExistsMake(Select().ColumnsString("1").FromString("t")),
+			sql:  "EXISTS (SELECT\n    1\nFROM\n    `t`)",
+			arg:  gin.H{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, arg, err := buildSQL(tt.cond)
+			if err != tt.err {
+				t.Fatalf("AppendToQuery error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if query != tt.sql {
+				t.Errorf("AppendToQuery sql: %s, want %s", query, tt.sql)
+			}
+			if !reflect.DeepEqual(arg, tt.arg) {
+				t.Errorf("AppendToQuery arg: %v, want %v", arg, tt.arg)
+			}
+		})
+	}
+}
+
+func TestInsertIDRange(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		lastID  int64
+		first   int64
+		last    int64
+	}{
+		{dialect: DialectMySQL, lastID: 10, first: 10, last: 12},
+		{dialect: DialectSQLite, lastID: 12, first: 10, last: 12},
+		{dialect: DialectPostgres, lastID: 12, first: 0, last: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect.Name(), func(t *testing.T) {
+			first, last := tt.dialect.InsertIDRange(tt.lastID, 3)
+			if first != tt.first || last != tt.last {
+				t.Errorf("InsertIDRange(%d, 3) = %d, %d, want %d, %d", tt.lastID, first, last, tt.first, tt.last)
+			}
+		})
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 // FormatMapKey 格式化字段名到key
 func FormatMapKey(oldKey string) string {
-	oldKey = strings.ReplaceAll(oldKey, "`", "")
+	oldKey = strings.NewReplacer("`", "", `"`, "").Replace(oldKey)
 	lastIndex := strings.LastIndex(oldKey, ".")
 	if lastIndex != -1 {
 		oldKey = oldKey[lastIndex+1:]
@@ -93,41 +93,23 @@ func SelectRows2Many(ctx context.Context, tx mdb.ExecuteAble, sourceRows []gin.H
 	return targetMap, keyValues, err
 }
 
-// SelectKeys2One 获取关联map
+// DefaultSelectKeysMaxCount 关联查询每次 IN 的最多数量
+const DefaultSelectKeysMaxCount = 1000
+
+// SelectKeys2One 获取关联map, key 为关联值的字符串, []byte 转换为字符串
 func SelectKeys2One(ctx context.Context, tx mdb.ExecuteAble, keyValues []interface{}, targetTableName, targetKey string, targetColumns []string) (map[string]gin.H, error) {
-	if len(keyValues) == 0 {
-		return nil, nil
-	}
-	if len(targetColumns) != 0 {
-		if !mutils.IsStringInSlice(targetColumns, targetKey) {
-			targetColumns = append(targetColumns, targetKey)
-		}
-	}
-	targetRows, err := Select().
-		ColumnsString(targetColumns...).
-		FromString(targetTableName).
-		Where(ConvertEqMake(targetKey, keyValues)).
-		Rows(
-			ctx,
-			tx,
-		)
-	if err != nil {
+	manyMap, err := SelectKeys2Many(ctx, tx, keyValues, targetTableName, targetKey, targetColumns)
+	if err != nil || manyMap == nil {
 		return nil, err
 	}
-	mapTargetKey := FormatMapKey(targetKey)
 	targetMap := map[string]gin.H{}
-	for _, targetRow := range targetRows {
-		kv, ok := targetRow[mapTargetKey]
-		if !ok {
-			return nil, fmt.Errorf("no target key: %s", mapTargetKey)
-		}
-		k := fmt.Sprintf("%v", kv)
-		targetMap[k] = targetRow
+	for k, rows := range manyMap {
+		targetMap[k] = rows[len(rows)-1]
 	}
 	return targetMap, nil
 }
 
-// SelectKeys2Many 获取关联map
+// SelectKeys2Many 获取关联map, key 为关联值的字符串, []byte 转换为字符串
 func SelectKeys2Many(ctx context.Context, tx mdb.ExecuteAble, keyValues []interface{}, targetTableName, targetKey string, targetColumns []string) (map[string][]gin.H, error) {
 	if len(keyValues) == 0 {
 		return nil, nil
@@ -137,26 +119,46 @@ func SelectKeys2Many(ctx context.Context, tx mdb.ExecuteAble, keyValues []interf
 			targetColumns = append(targetColumns, targetKey)
 		}
 	}
-	targetRows, err := Select().
+	q := Select().
 		ColumnsString(targetColumns...).
-		FromString(targetTableName).
-		Where(ConvertEqMake(targetKey, keyValues)).
-		Rows(
+		FromString(targetTableName)
+	return selectKeys2Many(ctx, tx, q, keyValues, targetKey, FormatMapKey(targetKey))
+}
+
+// keyString 关联值转换为map的key,查询值和结果值使用相同的转换, []byte 转换为字符串
+func keyString(v interface{}) (string, bool) {
+	k, ok := preloadKey(v)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%v", k), true
+}
+
+// selectKeys2Many 按 DefaultSelectKeysMaxCount 分批执行 targetKey IN 查询, 结果按 mapKey 列分组
+func selectKeys2Many(ctx context.Context, tx mdb.ExecuteAble, q *selectData, keyValues []interface{}, targetKey, mapKey string) (map[string][]gin.H, error) {
+	targetMap := map[string][]gin.H{}
+	for _, chunk := range splitChunks(keyValues, DefaultSelectKeysMaxCount, DefaultBatchMaxBytes) {
+		chunkQuery := *q
+		chunkQuery.whereParts = append(q.whereParts[:len(q.whereParts):len(q.whereParts)], ConvertEqMake(targetKey, chunk))
+		targetRows, err := chunkQuery.Rows(
 			ctx,
 			tx,
 		)
-	if err != nil {
-		return nil, err
-	}
-	mapTargetKey := FormatMapKey(targetKey)
-	targetMap := map[string][]gin.H{}
-	for _, targetRow := range targetRows {
-		kv, ok := targetRow[mapTargetKey]
-		if !ok {
-			return nil, fmt.Errorf("no target key: %s", mapTargetKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, targetRow := range targetRows {
+			kv, ok := targetRow[mapKey]
+			if !ok {
+				return nil, fmt.Errorf("no target key: %s", mapKey)
+			}
+			k, ok := keyString(kv)
+			if !ok {
+				// NULL 不会被关联
+				continue
+			}
+			targetMap[k] = append(targetMap[k], targetRow)
 		}
-		k := fmt.Sprintf("%v", kv)
-		targetMap[k] = append(targetMap[k], targetRow)
 	}
 	return targetMap, nil
 }
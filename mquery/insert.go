@@ -4,17 +4,23 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/moremorefun/mtool/mdb"
 )
 
 type insertData struct {
-	isIgnore       bool
-	into           string
-	columns        []string
-	values         []interface{}
-	duplicateParts []SQLAble
+	isIgnore        bool
+	into            string
+	columns         []string
+	values          []interface{}
+	duplicateParts  []SQLAble
+	conflictColumns []string
+	returning       []string
+	dialect         Dialect
+	structRows      interface{}
+	model           *Model
 }
 
 // Insert 创建搜索
@@ -53,39 +59,72 @@ func (q *insertData) Duplicates(duplicates ...SQLAble) *insertData {
 	return q
 }
 
+// OnConflict 冲突判断的列,postgres sqlite 的 upsert 需要
+func (q *insertData) OnConflict(columns ...string) *insertData {
+	q.conflictColumns = columns
+	return q
+}
+
+// Returning 返回列,方言不支持时忽略, DoExecuteLastID 使用第一列作为id
+func (q *insertData) Returning(columns ...string) *insertData {
+	q.returning = columns
+	return q
+}
+
+// Dialect 设置方言,默认使用 SetDefaultDialect 设置的方言
+func (q *insertData) Dialect(d Dialect) *insertData {
+	q.dialect = d
+	return q
+}
+
+// getDialect 获取方言
+func (q *insertData) getDialect() Dialect {
+	if q.dialect == nil {
+		return defaultDialect
+	}
+	return q.dialect
+}
+
+// isReturning 是否使用 RETURNING
+func (q *insertData) isReturning() bool {
+	return len(q.returning) > 0 && q.getDialect().IsSupportReturning()
+}
+
 // ToSQL 生成sql
 func (q *insertData) ToSQL() (string, gin.H, error) {
 	var err error
 
 	var buf bytes.Buffer
 	arg := gin.H{}
-	buf.WriteString("INSERT")
-	if q.isIgnore {
-		buf.WriteString(" IGNORE")
-	}
-	buf.WriteString(" INTO ")
+	d := q.getDialect()
+	buf.WriteString(d.InsertSQL(q.isIgnore))
+	buf.WriteString(" ")
 	if len(q.into) == 0 {
 		return "", nil, fmt.Errorf("insert no into")
 	}
-	buf.WriteString(q.into)
-	if len(q.columns) == 0 {
+	buf.WriteString(quoteIdent(d, q.into))
+	columns, values, err := q.getColumnsValues()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(columns) == 0 {
 		return "", nil, fmt.Errorf("insert no columns")
 	}
 	buf.WriteString(" (")
-	lastColumnIndex := len(q.columns) - 1
-	for i, column := range q.columns {
+	lastColumnIndex := len(columns) - 1
+	for i, column := range columns {
 		buf.WriteString("\n    ")
-		buf.WriteString(column)
+		buf.WriteString(quoteIdent(d, column))
 		if i != lastColumnIndex {
 			buf.WriteString(",")
 		}
 	}
 	buf.WriteString("\n) VALUES")
-	if len(q.values) == 0 {
+	if len(values) == 0 {
 		return "", nil, fmt.Errorf("insert values empty")
 	}
-	lastValueIndex := len(q.values) - 1
-	for i, value := range q.values {
+	lastValueIndex := len(values) - 1
+	for i, value := range values {
 		k := fmt.Sprintf("value%d", i)
 		buf.WriteString("\n(:")
 		buf.WriteString(k)
@@ -95,20 +134,40 @@ func (q *insertData) ToSQL() (string, gin.H, error) {
 		}
 		arg[k] = value
 	}
-	if len(q.duplicateParts) > 0 {
-		buf.WriteString("\nON DUPLICATE KEY UPDATE")
-		lastDuplicateIndex := len(q.duplicateParts) - 1
-		for i, duplicate := range q.duplicateParts {
+	duplicateParts := q.duplicateParts
+	if q.model != nil {
+		duplicateParts = q.model.fillDuplicates(duplicateParts)
+	}
+	upsertSQL, err := d.UpsertSQL(q.isIgnore, quoteIdents(d, q.conflictColumns), len(duplicateParts) > 0)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(upsertSQL) > 0 {
+		buf.WriteString("\n")
+		buf.WriteString(upsertSQL)
+	}
+	if len(duplicateParts) > 0 {
+		lastDuplicateIndex := len(duplicateParts) - 1
+		for i, duplicate := range duplicateParts {
 			buf.WriteString("\n    ")
-			buf, arg, err = duplicate.AppendToQuery(buf, arg)
-			if err != nil {
-				return "", nil, err
+			v, ok := duplicate.(ConvertValues)
+			if ok {
+				buf.WriteString(d.UpsertValue(quoteIdent(d, string(v))))
+			} else {
+				buf, arg, err = appendPart(buf, arg, d, duplicate)
+				if err != nil {
+					return "", nil, err
+				}
 			}
 			if i != lastDuplicateIndex {
 				buf.WriteString(",")
 			}
 		}
 	}
+	if q.isReturning() {
+		buf.WriteString("\nRETURNING ")
+		buf.WriteString(strings.Join(quoteIdents(d, q.returning), ", "))
+	}
 	return buf.String(), arg, nil
 }
 
@@ -118,6 +177,20 @@ func (q *insertData) DoExecuteLastID(ctx context.Context, tx mdb.ExecuteAble) (i
 	if err != nil {
 		return 0, err
 	}
+	if q.isReturning() {
+		var lastID int64
+		_, err = mdb.GetContent(
+			ctx,
+			tx,
+			&lastID,
+			query,
+			arg,
+		)
+		if err != nil {
+			return 0, err
+		}
+		return lastID, nil
+	}
 	return mdb.ExecuteLastIDContent(
 		ctx,
 		tx,
@@ -0,0 +1,288 @@
+package mquery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// 批量插入默认限制
+const (
+	DefaultBatchMaxRows  = 1000
+	DefaultBatchMaxBytes = 1 << 20
+)
+
+// BatchConfig 批量插入配置
+type BatchConfig struct {
+	// MaxRows 每批最多行数,默认1000
+	MaxRows int
+	// MaxBytes 每批参数的估算最大字节数,默认1MB,需要小于 max_allowed_packet
+	MaxBytes int
+	// InTransaction 所有批次在一个事务中执行
+	InTransaction bool
+}
+
+// BatchChunkResult 单批执行结果
+type BatchChunkResult struct {
+	Rows     int
+	Affected int64
+	// FirstID LastID 自增id范围,只在普通插入且id连续时有效, ignore 和 upsert 时为0
+	FirstID int64
+	LastID  int64
+}
+
+// BatchResult 批量插入结果
+type BatchResult struct {
+	Affected int64
+	Chunks   []BatchChunkResult
+}
+
+// Structs 从结构体切片生成列和值
+// 列名取自db标签, autoincr 选项的列不插入, omitempty 选项的列在所有行都为零值时不插入
+func (q *insertData) Structs(rows interface{}) *insertData {
+	q.structRows = rows
+	return q
+}
+
+// getColumnsValues 获取列和值
+func (q *insertData) getColumnsValues() ([]string, []interface{}, error) {
+	columns, values := q.columns, q.values
+	if q.structRows != nil {
+		var err error
+		columns, values, err = structsToValues(q.structRows)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if q.model != nil {
+		return q.model.fillInsert(columns, values)
+	}
+	return columns, values, nil
+}
+
+// structsToValues 结构体切片转换为列和值
+func structsToValues(rows interface{}) ([]string, []interface{}, error) {
+	rv := reflect.ValueOf(rows)
+	if rv.Kind() != reflect.Slice {
+		return nil, nil, fmt.Errorf("insert structs must be slice: %T", rows)
+	}
+	et := rv.Type().Elem()
+	for et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("insert structs must be slice of struct: %T", rows)
+	}
+	l := rv.Len()
+	elems := make([]reflect.Value, l)
+	for i := 0; i < l; i++ {
+		ev := rv.Index(i)
+		for ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				return nil, nil, fmt.Errorf("insert structs nil row: %d", i)
+			}
+			ev = ev.Elem()
+		}
+		elems[i] = ev
+	}
+	var columns []string
+	var fields []mdb.StructField
+	for _, field := range mdb.GetStructFields(et) {
+		if field.HasOption("autoincr") {
+			continue
+		}
+		if field.HasOption("omitempty") {
+			isAllZero := true
+			for _, ev := range elems {
+				fv, ok := fieldByIndexRead(ev, field.Index)
+				if ok && !fv.IsZero() {
+					isAllZero = false
+					break
+				}
+			}
+			if isAllZero {
+				continue
+			}
+		}
+		columns = append(columns, field.Name)
+		fields = append(fields, field)
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("insert structs no columns: %s", et)
+	}
+	values := make([]interface{}, l)
+	for i, ev := range elems {
+		row := make([]interface{}, len(fields))
+		for j, field := range fields {
+			fv, ok := fieldByIndexRead(ev, field.Index)
+			if !ok {
+				continue
+			}
+			row[j] = fv.Interface()
+		}
+		values[i] = row
+	}
+	return columns, values, nil
+}
+
+// fieldByIndexRead 读取字段,空指针返回false
+func fieldByIndexRead(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// estimateSize 估算值写入sql后的字节数
+func estimateSize(v interface{}) int {
+	switch tv := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(tv) + 2
+	case []byte:
+		return len(tv)*2 + 3
+	case time.Time:
+		return 28
+	case []interface{}:
+		size := 2
+		for _, iv := range tv {
+			size += estimateSize(iv) + 2
+		}
+		return size
+	}
+	return len(fmt.Sprint(v))
+}
+
+// splitChunks 按行数和字节数分批
+func splitChunks(values []interface{}, maxRows, maxBytes int) [][]interface{} {
+	var chunks [][]interface{}
+	start := 0
+	size := 0
+	for i, value := range values {
+		valueSize := estimateSize(value)
+		if i > start && (i-start >= maxRows || size+valueSize > maxBytes) {
+			chunks = append(chunks, values[start:i])
+			start = i
+			size = 0
+		}
+		size += valueSize
+	}
+	if start < len(values) {
+		chunks = append(chunks, values[start:])
+	}
+	return chunks
+}
+
+// DoBatch 分批执行插入
+func (q *insertData) DoBatch(ctx context.Context, tx mdb.ExecuteAble, conf BatchConfig) (*BatchResult, error) {
+	if conf.MaxRows <= 0 {
+		conf.MaxRows = DefaultBatchMaxRows
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = DefaultBatchMaxBytes
+	}
+	columns, values, err := q.getColumnsValues()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return &BatchResult{}, nil
+	}
+	chunks := splitChunks(values, conf.MaxRows, conf.MaxBytes)
+	var result BatchResult
+	run := func(dbTx mdb.ExecuteAble) error {
+		result = BatchResult{}
+		for _, chunk := range chunks {
+			c := *q
+			c.structRows = nil
+			c.columns = columns
+			c.values = chunk
+			chunkResult, err := c.doChunk(ctx, dbTx)
+			if err != nil {
+				return err
+			}
+			result.Affected += chunkResult.Affected
+			result.Chunks = append(result.Chunks, chunkResult)
+		}
+		return nil
+	}
+	if conf.InTransaction {
+		err = mdb.Transaction(ctx, tx, run)
+	} else {
+		err = run(tx)
+	}
+	if err != nil {
+		return &result, err
+	}
+	return &result, nil
+}
+
+// isPlainInsert 是否普通插入,只有普通插入可以得到id范围
+func (q *insertData) isPlainInsert() bool {
+	return !q.isIgnore && len(q.duplicateParts) == 0
+}
+
+// doChunk 执行单批
+func (q *insertData) doChunk(ctx context.Context, tx mdb.ExecuteAble) (BatchChunkResult, error) {
+	chunkResult := BatchChunkResult{
+		Rows: len(q.values),
+	}
+	query, arg, err := q.ToSQL()
+	if err != nil {
+		return chunkResult, err
+	}
+	if q.isReturning() {
+		var ids []int64
+		err = mdb.SelectContent(
+			ctx,
+			tx,
+			&ids,
+			query,
+			arg,
+		)
+		if err != nil {
+			return chunkResult, err
+		}
+		chunkResult.Affected = int64(len(ids))
+		if len(ids) > 0 && q.isPlainInsert() {
+			chunkResult.FirstID = ids[0]
+			chunkResult.LastID = ids[len(ids)-1]
+		}
+		return chunkResult, nil
+	}
+	ret, err := mdb.ExecuteContent(
+		ctx,
+		tx,
+		query,
+		arg,
+	)
+	if err != nil {
+		return chunkResult, err
+	}
+	chunkResult.Affected, err = ret.RowsAffected()
+	if err != nil {
+		return chunkResult, err
+	}
+	if !q.isPlainInsert() || chunkResult.Affected != int64(chunkResult.Rows) {
+		// ignore 和 upsert 时影响行数和id不对应
+		return chunkResult, nil
+	}
+	lastID, err := ret.LastInsertId()
+	if err == nil && lastID > 0 {
+		chunkResult.FirstID, chunkResult.LastID = q.getDialect().InsertIDRange(lastID, chunkResult.Affected)
+	}
+	return chunkResult, nil
+}
@@ -17,6 +17,7 @@ type joinData struct {
 	joinType int64
 	table    SQLAble
 	onParts  []SQLAble
+	dialect  Dialect
 }
 
 // Join 链接
@@ -35,7 +36,7 @@ func (q *joinData) Table(from SQLAble) *joinData {
 
 // FromString 表名
 func (q *joinData) TableString(from string) *joinData {
-	q.table = ConvertRaw(from)
+	q.table = ident(from)
 	return q
 }
 
@@ -45,6 +46,20 @@ func (q *joinData) On(cond ...SQLAble) *joinData {
 	return q
 }
 
+// Dialect 设置方言,默认使用所在语句的方言
+func (q *joinData) Dialect(d Dialect) *joinData {
+	q.dialect = d
+	return q
+}
+
+// getDialect 获取方言
+func (q *joinData) getDialect() Dialect {
+	if q.dialect == nil {
+		return defaultDialect
+	}
+	return q.dialect
+}
+
 // ToSQL 生成sql
 func (q *joinData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
 	var err error
@@ -65,7 +80,7 @@ func (q *joinData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin
 	if q.table == nil {
 		return bytes.Buffer{}, nil, fmt.Errorf("join no table")
 	}
-	buf, arg, err = q.table.AppendToQuery(buf, arg)
+	buf, arg, err = appendPart(buf, arg, q.getDialect(), q.table)
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
@@ -78,7 +93,7 @@ func (q *joinData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin
 		if i != 0 {
 			buf.WriteString("AND ")
 		}
-		buf, arg, err = on.AppendToQuery(buf, arg)
+		buf, arg, err = appendPart(buf, arg, q.getDialect(), on)
 		if err != nil {
 			return bytes.Buffer{}, nil, err
 		}
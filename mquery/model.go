@@ -0,0 +1,214 @@
+package mquery
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelConfig 表模型配置,列名为空时不处理对应功能
+type ModelConfig struct {
+	Table string
+	// PrimaryKey 主键,默认 id
+	PrimaryKey string
+	// CreatedAt 插入时填充的时间列
+	CreatedAt string
+	// UpdatedAt 插入和更新时填充的时间列
+	UpdatedAt string
+	// DeletedAt 软删除时间列,为 NULL 表示未删除
+	DeletedAt string
+	// NowFunc 获取当前时间,默认 time.Now
+	NowFunc func() time.Time
+}
+
+// Model 表模型
+// 通过模型创建的 Insert Update 自动填充时间, Delete 转为更新删除时间, Select Update Delete 过滤已删除的行
+// 调用 Unscoped 后不过滤已删除的行, Delete 为真实删除
+type Model struct {
+	conf ModelConfig
+}
+
+var (
+	modelMutex sync.RWMutex
+	models     = map[string]*Model{}
+)
+
+// RegisterModel 注册表模型,相同表名会覆盖
+func RegisterModel(conf ModelConfig) *Model {
+	if len(conf.PrimaryKey) == 0 {
+		conf.PrimaryKey = "id"
+	}
+	if conf.NowFunc == nil {
+		conf.NowFunc = time.Now
+	}
+	m := &Model{
+		conf: conf,
+	}
+	modelMutex.Lock()
+	models[conf.Table] = m
+	modelMutex.Unlock()
+	return m
+}
+
+// GetModel 获取已注册的表模型
+func GetModel(table string) (*Model, bool) {
+	modelMutex.RLock()
+	defer modelMutex.RUnlock()
+	m, ok := models[table]
+	return m, ok
+}
+
+// Table 表名
+func (m *Model) Table() string {
+	return m.conf.Table
+}
+
+// PrimaryKey 主键
+func (m *Model) PrimaryKey() string {
+	return m.conf.PrimaryKey
+}
+
+// PKEq 主键条件
+func (m *Model) PKEq(v interface{}) ConvertEq {
+	return ConvertEqMake(m.conf.PrimaryKey, v)
+}
+
+// Insert 创建插入
+func (m *Model) Insert() *insertData {
+	q := Insert().Into(m.conf.Table)
+	q.model = m
+	return q
+}
+
+// Update 创建更新
+func (m *Model) Update() *updateData {
+	q := Update().Table(m.conf.Table)
+	q.model = m
+	return q
+}
+
+// Select 创建搜索
+func (m *Model) Select() *selectData {
+	q := Select().FromString(m.conf.Table)
+	q.model = m
+	return q
+}
+
+// Delete 创建删除
+func (m *Model) Delete() *deleteData {
+	q := Delete().Table(m.conf.Table)
+	q.model = m
+	return q
+}
+
+// isSoftDelete 是否软删除
+func (m *Model) isSoftDelete() bool {
+	return len(m.conf.DeletedAt) > 0
+}
+
+// notDeletedCond 未删除条件, isQualify 时使用表别名限定列名
+func (m *Model) notDeletedCond(table string, isQualify bool) SQLAble {
+	col := m.conf.DeletedAt
+	if isQualify {
+		col = tableAlias(table) + "." + col
+	}
+	return ConvertIsNull(col)
+}
+
+// fillInsert 插入时补充时间列,已存在的列不处理
+func (m *Model) fillInsert(columns []string, values []interface{}) ([]string, []interface{}, error) {
+	var addColumns []string
+	for _, col := range []string{m.conf.CreatedAt, m.conf.UpdatedAt} {
+		if len(col) == 0 || hasColumn(columns, col) || hasColumn(addColumns, col) {
+			continue
+		}
+		addColumns = append(addColumns, col)
+	}
+	if len(addColumns) == 0 {
+		return columns, values, nil
+	}
+	now := m.conf.NowFunc()
+	newColumns := make([]string, 0, len(columns)+len(addColumns))
+	newColumns = append(newColumns, columns...)
+	newColumns = append(newColumns, addColumns...)
+	newValues := make([]interface{}, len(values))
+	for i, value := range values {
+		row, ok := value.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("model insert value must be []interface{}: %T", value)
+		}
+		newRow := make([]interface{}, 0, len(row)+len(addColumns))
+		newRow = append(newRow, row...)
+		for range addColumns {
+			newRow = append(newRow, now)
+		}
+		newValues[i] = newRow
+	}
+	return newColumns, newValues, nil
+}
+
+// fillDuplicates upsert 时补充更新时间
+func (m *Model) fillDuplicates(duplicateParts []SQLAble) []SQLAble {
+	col := m.conf.UpdatedAt
+	if len(duplicateParts) == 0 || len(col) == 0 || hasSetColumn(duplicateParts, col) {
+		return duplicateParts
+	}
+	parts := make([]SQLAble, 0, len(duplicateParts)+1)
+	parts = append(parts, duplicateParts...)
+	return append(parts, ConvertValues(col))
+}
+
+// fillUpdate 更新时补充更新时间
+func (m *Model) fillUpdate(table string, updateParts []SQLAble, isQualify bool) []SQLAble {
+	col := m.conf.UpdatedAt
+	if len(col) == 0 || hasSetColumn(updateParts, col) {
+		return updateParts
+	}
+	if isQualify {
+		col = tableAlias(table) + "." + col
+	}
+	parts := make([]SQLAble, 0, len(updateParts)+1)
+	parts = append(parts, updateParts...)
+	return append(parts, ConvertEqMake(col, m.conf.NowFunc()))
+}
+
+// tableAlias "table t" 和 "table AS t" 取别名 t
+func tableAlias(table string) string {
+	fields := strings.Fields(table)
+	if len(fields) == 0 {
+		return table
+	}
+	return fields[len(fields)-1]
+}
+
+// hasColumn 列是否存在
+func hasColumn(columns []string, col string) bool {
+	for _, column := range columns {
+		if column == col {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSetColumn 更新内容中是否已经设置列
+func hasSetColumn(parts []SQLAble, col string) bool {
+	for _, part := range parts {
+		var k string
+		switch v := part.(type) {
+		case ConvertEq:
+			k = v.K
+		case ConvertEqRaw:
+			k = v.K
+		case ConvertValues:
+			k = string(v)
+		default:
+			continue
+		}
+		if k == col || strings.HasSuffix(k, "."+col) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package mquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// ErrStaleVersion 乐观锁版本已变化,没有行被更新
+var ErrStaleVersion = errors.New("stale version")
+
+// Version 乐观锁,更新时设置 col=col+1 并添加 col=:version 条件
+// 使用 DoExecuteVersion 执行
+func (q *updateData) Version(col string, version interface{}) *updateData {
+	q.versionCol = col
+	q.version = version
+	return q
+}
+
+// DoExecuteVersion 执行乐观锁更新,没有行被更新时返回 ErrStaleVersion
+func (q *updateData) DoExecuteVersion(ctx context.Context, tx mdb.ExecuteAble) error {
+	if len(q.versionCol) == 0 {
+		return fmt.Errorf("update no version")
+	}
+	count, err := q.DoExecuteCount(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrStaleVersion
+	}
+	return nil
+}
+
+// VersionUpdater 乐观锁更新,由 Update().Version() 创建
+type VersionUpdater interface {
+	DoExecuteVersion(ctx context.Context, tx mdb.ExecuteAble) error
+}
+
+// isNilUpdater 是否为空,接口中的 nil 指针也为空
+func isNilUpdater(q VersionUpdater) bool {
+	if q == nil {
+		return true
+	}
+	rv := reflect.ValueOf(q)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// DoVersionRetry 乐观锁重试
+// 每次尝试开启新的事务, f 中在 tx 上重新读取行并返回设置了 Version 的更新,
+// 版本冲突时回滚并重新调用 f, 最多执行 maxAttempts 次
+// 使用新事务是因为 REPEATABLE READ 下同一个事务重新读取仍是旧版本,
+// 所以 db 已经是事务时只在保存点中执行一次
+// f 返回 nil 时表示不需要更新
+func DoVersionRetry(ctx context.Context, db mdb.ExecuteAble, maxAttempts int, f func(ctx context.Context, tx mdb.ExecuteAble) (VersionUpdater, error)) error {
+	switch db.(type) {
+	case *mdb.Tx, *sqlx.Tx:
+		maxAttempts = 1
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	var err error
+	for i := 0; i < maxAttempts; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = mdb.Transaction(ctx, db, func(dbTx mdb.ExecuteAble) error {
+			q, err := f(ctx, dbTx)
+			if err != nil {
+				return err
+			}
+			if isNilUpdater(q) {
+				return nil
+			}
+			return q.DoExecuteVersion(ctx, dbTx)
+		})
+		if err != ErrStaleVersion {
+			return err
+		}
+	}
+	return err
+}
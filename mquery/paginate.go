@@ -0,0 +1,252 @@
+package mquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// Page 分页结果
+type Page struct {
+	Items    []gin.H `json:"items"`
+	Total    int64   `json:"total"`
+	Page     int64   `json:"page"`
+	PageSize int64   `json:"page_size"`
+}
+
+// CursorPage 游标分页结果
+type CursorPage struct {
+	Items []gin.H `json:"items"`
+	// NextToken 下一页标记,为空时没有下一页
+	NextToken string `json:"next_token"`
+}
+
+// countQuery 生成计数查询,去掉排序和分页,有分组时作为子查询
+func (q *selectData) countQuery() *selectData {
+	c := q.clone()
+	c.orderByParts = nil
+	c.offset = 0
+	c.limit = 0
+	c.isForUpdate = false
+	c.isSkipLocked = false
+	c.as = ""
+	if len(c.groupBys) > 0 {
+		return Select().
+			Dialect(c.getDialect()).
+			Columns(ConvertFuncAsMake("COUNT", "*", "c")).
+			From(c.As("t"))
+	}
+	c.columns = []SQLAble{ConvertFuncAsMake("COUNT", "*", "c")}
+	return c
+}
+
+// DoCount 获取总数
+func (q *selectData) DoCount(ctx context.Context, tx mdb.ExecuteAble) (int64, error) {
+	var total int64
+	_, err := q.countQuery().DoGet(ctx, tx, &total)
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// pageQuery 生成分页查询
+func (q *selectData) pageQuery(page, pageSize int64) (*selectData, error) {
+	if page <= 0 || pageSize <= 0 {
+		return nil, fmt.Errorf("paginate page and page size must > 0")
+	}
+	return q.clone().Limit(pageSize).Offset((page - 1) * pageSize), nil
+}
+
+// DoPaginate 分页获取数据和总数, page 从1开始
+func (q *selectData) DoPaginate(ctx context.Context, tx mdb.ExecuteAble, page, pageSize int64) (*Page, error) {
+	pq, err := q.pageQuery(page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	ret := Page{
+		Page:     page,
+		PageSize: pageSize,
+	}
+	ret.Total, err = q.DoCount(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Total <= (page-1)*pageSize {
+		return &ret, nil
+	}
+	ret.Items, err = pq.Rows(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DoPaginateScan 分页获取数据写入 dest 结构体切片,返回的 Page 中没有 Items
+func (q *selectData) DoPaginateScan(ctx context.Context, tx mdb.ExecuteAble, page, pageSize int64, dest interface{}) (*Page, error) {
+	pq, err := q.pageQuery(page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	ret := Page{
+		Page:     page,
+		PageSize: pageSize,
+	}
+	ret.Total, err = q.DoCount(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Total <= (page-1)*pageSize {
+		return &ret, nil
+	}
+	err = pq.DoScan(ctx, tx, dest)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// convertTuple (a, b) op (:a, :b)
+type convertTuple struct {
+	keys   []string
+	op     string
+	values []interface{}
+}
+
+// AppendToQuery 写入sql,填充arg
+func (o convertTuple) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	return o.appendDialect(buf, arg, nil)
+}
+
+// appendDialect 按方言写入sql,填充arg
+func (o convertTuple) appendDialect(buf bytes.Buffer, arg gin.H, d Dialect) (bytes.Buffer, gin.H, error) {
+	var err error
+	if len(o.keys) != len(o.values) {
+		return bytes.Buffer{}, nil, fmt.Errorf("cursor token keys len error")
+	}
+	if len(o.keys) == 1 {
+		return appendCompare(buf, arg, d, o.keys[0], o.op, o.values[0])
+	}
+	buf.WriteString("(")
+	for i, key := range o.keys {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(quoteKey(d, key))
+	}
+	buf.WriteString(")")
+	buf.WriteString(o.op)
+	buf.WriteString("(")
+	for i, key := range o.keys {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf, arg, err = appendValue(buf, arg, d, key, o.values[i])
+		if err != nil {
+			return bytes.Buffer{}, nil, err
+		}
+	}
+	buf.WriteString(")")
+	return buf, arg, nil
+}
+
+// encodeCursorToken 编码最后一行的排序键
+func encodeCursorToken(row gin.H, keys []string) (string, error) {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		v, ok := row[FormatMapKey(key)]
+		if !ok {
+			return "", fmt.Errorf("no cursor key: %s", key)
+		}
+		t, ok := v.(time.Time)
+		if ok {
+			v = t.Format("2006-01-02 15:04:05.999999")
+		}
+		values[i] = v
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursorToken 解码排序键
+func decodeCursorToken(token string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("cursor token error: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var values []interface{}
+	err = decoder.Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("cursor token error: %w", err)
+	}
+	for i, v := range values {
+		n, ok := v.(json.Number)
+		if ok {
+			values[i] = n.String()
+		}
+	}
+	return values, nil
+}
+
+// DoCursorPaginate 游标分页,按 keys 排序, keys 组合需要唯一
+// token 为上一页返回的 NextToken, 第一页传空
+func (q *selectData) DoCursorPaginate(ctx context.Context, tx mdb.ExecuteAble, keys []string, isDesc bool, token string, pageSize int64) (*CursorPage, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("cursor paginate no keys")
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("paginate page size must > 0")
+	}
+	pq := q.clone()
+	pq.orderByParts = nil
+	for _, key := range keys {
+		if isDesc {
+			pq.orderByParts = append(pq.orderByParts, ConvertDesc(key))
+		} else {
+			pq.orderByParts = append(pq.orderByParts, ConvertRaw(key))
+		}
+	}
+	if len(token) > 0 {
+		values, err := decodeCursorToken(token)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if isDesc {
+			op = "<"
+		}
+		pq.whereParts = append(pq.whereParts, convertTuple{
+			keys:   keys,
+			op:     op,
+			values: values,
+		})
+	}
+	// 多取一行判断是否有下一页
+	pq.offset = 0
+	pq.limit = pageSize + 1
+	rows, err := pq.Rows(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	var ret CursorPage
+	if int64(len(rows)) > pageSize {
+		rows = rows[:pageSize]
+		ret.NextToken, err = encodeCursorToken(rows[len(rows)-1], keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret.Items = rows
+	return &ret, nil
+}
@@ -0,0 +1,482 @@
+package mquery
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moremorefun/mtool/mdb"
+	"github.com/moremorefun/mtool/mutils"
+)
+
+// 关联类型
+const (
+	RelationOne        = 1
+	RelationMany       = 2
+	RelationManyToMany = 3
+)
+
+// preloadKeyColumn 多对多时中间表的关联列别名
+const preloadKeyColumn = "mquery_preload_key"
+
+// Relation 表关联
+// RelationOne RelationMany: 源表 LocalKey = 目标表 ForeignKey
+// RelationManyToMany: 源表 LocalKey = 中间表 JoinLocalKey, 中间表 JoinForeignKey = 目标表 ForeignKey
+type Relation struct {
+	// Name 关联名,用于预加载路径
+	Name string
+	Type int64
+	// Table 目标表,已注册模型时过滤软删除的行
+	Table      string
+	LocalKey   string
+	ForeignKey string
+
+	JoinTable      string
+	JoinLocalKey   string
+	JoinForeignKey string
+
+	// Columns 目标表列,为空时查询所有列
+	Columns  []string
+	Where    []SQLAble
+	OrderBys []string
+	// Field 结果写入的字段,结构体使用字段名,行使用key,默认为 Name
+	// 结构体中的关联字段需要设置 db:"-"
+	Field string
+}
+
+var (
+	relationMutex sync.RWMutex
+	relations     = map[string]map[string]Relation{}
+)
+
+// DefineRelations 注册表的关联,相同名称会覆盖
+func DefineRelations(table string, rels ...Relation) {
+	relationMutex.Lock()
+	defer relationMutex.Unlock()
+	m, ok := relations[table]
+	if !ok {
+		m = map[string]Relation{}
+		relations[table] = m
+	}
+	for _, rel := range rels {
+		if len(rel.Field) == 0 {
+			rel.Field = rel.Name
+		}
+		m[rel.Name] = rel
+	}
+}
+
+// GetRelation 获取表的关联
+func GetRelation(table, name string) (Relation, bool) {
+	relationMutex.RLock()
+	defer relationMutex.RUnlock()
+	rel, ok := relations[table][name]
+	return rel, ok
+}
+
+// Relations 注册模型的关联
+func (m *Model) Relations(rels ...Relation) *Model {
+	DefineRelations(m.conf.Table, rels...)
+	return m
+}
+
+// preloadTree 预加载路径树
+type preloadTree map[string]preloadTree
+
+// buildPreloadTree 合并路径
+func buildPreloadTree(paths []string) preloadTree {
+	tree := preloadTree{}
+	for _, path := range paths {
+		node := tree
+		for _, name := range strings.Split(path, ".") {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 {
+				continue
+			}
+			child, ok := node[name]
+			if !ok {
+				child = preloadTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// preloadNode 预加载的一项,行或可寻址的结构体
+type preloadNode struct {
+	row gin.H
+	sv  reflect.Value
+}
+
+// get 获取列的值
+func (n preloadNode) get(col string) (interface{}, bool) {
+	col = FormatMapKey(col)
+	if n.row != nil {
+		v, ok := n.row[col]
+		return v, ok
+	}
+	for _, field := range mdb.GetStructFields(n.sv.Type()) {
+		if field.Name != col {
+			continue
+		}
+		fv, ok := fieldByIndexRead(n.sv, field.Index)
+		if !ok {
+			return nil, true
+		}
+		if fv.Kind() == reflect.Ptr {
+			fv = fv.Elem()
+		}
+		return fv.Interface(), true
+	}
+	return nil, false
+}
+
+// Preload 预加载关联,每层关联按 DefaultSelectKeysMaxCount 分批执行 IN 查询
+// table 为 dest 对应的表, paths 如 "order.items.product"
+// dest 可以是 gin.H []gin.H *[]gin.H 结构体指针 结构体切片或其指针
+func Preload(ctx context.Context, tx mdb.ExecuteAble, table string, dest interface{}, paths ...string) error {
+	nodes, err := preloadNodes(dest)
+	if err != nil {
+		return err
+	}
+	return preloadLevel(ctx, tx, table, nodes, buildPreloadTree(paths))
+}
+
+// preloadNodes 获取要加载的项
+func preloadNodes(dest interface{}) ([]preloadNode, error) {
+	switch v := dest.(type) {
+	case gin.H:
+		return []preloadNode{{row: v}}, nil
+	case []gin.H:
+		nodes := make([]preloadNode, len(v))
+		for i, row := range v {
+			nodes[i] = preloadNode{row: row}
+		}
+		return nodes, nil
+	case *[]gin.H:
+		return preloadNodes(*v)
+	}
+	rv := reflect.ValueOf(dest)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("preload dest nil: %T", dest)
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		if !rv.CanAddr() {
+			return nil, fmt.Errorf("preload dest must be pointer: %T", dest)
+		}
+		return []preloadNode{{sv: rv}}, nil
+	case reflect.Slice:
+		var nodes []preloadNode
+		for i := 0; i < rv.Len(); i++ {
+			ev := rv.Index(i)
+			for ev.Kind() == reflect.Ptr || ev.Kind() == reflect.Interface {
+				if ev.IsNil() {
+					break
+				}
+				ev = ev.Elem()
+			}
+			switch {
+			case ev.Kind() == reflect.Struct && ev.CanAddr():
+				nodes = append(nodes, preloadNode{sv: ev})
+			case ev.Kind() == reflect.Map && ev.Type().ConvertibleTo(reflect.TypeOf(gin.H{})):
+				nodes = append(nodes, preloadNode{row: ev.Convert(reflect.TypeOf(gin.H{})).Interface().(gin.H)})
+			case ev.Kind() == reflect.Ptr || ev.Kind() == reflect.Interface:
+				// 空指针
+			default:
+				return nil, fmt.Errorf("preload dest not support: %T", dest)
+			}
+		}
+		return nodes, nil
+	}
+	return nil, fmt.Errorf("preload dest not support: %T", dest)
+}
+
+// preloadLevel 加载一层关联,子关联先加载再写入
+func preloadLevel(ctx context.Context, tx mdb.ExecuteAble, table string, nodes []preloadNode, tree preloadTree) error {
+	if len(nodes) == 0 || len(tree) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rel, ok := GetRelation(table, name)
+		if !ok {
+			return fmt.Errorf("no relation: %s.%s", table, name)
+		}
+		err := preloadRelation(ctx, tx, rel, nodes, tree[name])
+		if err != nil {
+			return fmt.Errorf("preload %s.%s: %w", table, name, err)
+		}
+	}
+	return nil
+}
+
+// preloadRelation 加载一个关联
+func preloadRelation(ctx context.Context, tx mdb.ExecuteAble, rel Relation, nodes []preloadNode, tree preloadTree) error {
+	var keys []interface{}
+	seen := map[interface{}]bool{}
+	nodeKeys := make([]interface{}, len(nodes))
+	for i, node := range nodes {
+		v, ok := node.get(rel.LocalKey)
+		if !ok {
+			return fmt.Errorf("no key: %s", rel.LocalKey)
+		}
+		k, ok := preloadKey(v)
+		if !ok {
+			continue
+		}
+		nodeKeys[i] = k
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	childType, err := preloadChildType(rel, nodes)
+	if err != nil {
+		return err
+	}
+	var targetMap map[string][]gin.H
+	if len(keys) > 0 {
+		targetMap, err = preloadRows(ctx, tx, rel, keys)
+		if err != nil {
+			return err
+		}
+	}
+	var rows []gin.H
+	groups := map[interface{}][]int{}
+	for _, k := range keys {
+		mapKey, _ := keyString(k)
+		for _, row := range targetMap[mapKey] {
+			if rel.Type == RelationManyToMany {
+				delete(row, preloadKeyColumn)
+			}
+			groups[k] = append(groups[k], len(rows))
+			rows = append(rows, row)
+		}
+	}
+	// 生成子项并加载下一层
+	children := make([]preloadNode, len(rows))
+	childValues := make([]reflect.Value, len(rows))
+	for i, row := range rows {
+		if childType == nil {
+			children[i] = preloadNode{row: row}
+			continue
+		}
+		p := reflect.New(childType)
+		err = mdb.MapToStruct(row, p.Interface())
+		if err != nil {
+			return err
+		}
+		children[i] = preloadNode{sv: p.Elem()}
+		childValues[i] = p
+	}
+	err = preloadLevel(ctx, tx, rel.Table, children, tree)
+	if err != nil {
+		return err
+	}
+	// 写入
+	for i, node := range nodes {
+		var indexes []int
+		if nodeKeys[i] != nil {
+			indexes = groups[nodeKeys[i]]
+		}
+		if node.row != nil {
+			node.row[rel.Field] = preloadRowsValue(rel, children, indexes)
+			continue
+		}
+		err = preloadAttachStruct(rel, node.sv, children, childValues, indexes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadChildType 结构体关联字段的元素类型,写入行时返回nil
+func preloadChildType(rel Relation, nodes []preloadNode) (reflect.Type, error) {
+	for _, node := range nodes {
+		if node.row != nil {
+			return nil, nil
+		}
+		field, ok := node.sv.Type().FieldByName(rel.Field)
+		if !ok {
+			return nil, fmt.Errorf("no field: %s", rel.Field)
+		}
+		t := field.Type
+		if t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			return t, nil
+		}
+		return nil, nil
+	}
+	return nil, nil
+}
+
+// preloadRows 分批查询目标行,按关联值分组
+func preloadRows(ctx context.Context, tx mdb.ExecuteAble, rel Relation, keys []interface{}) (map[string][]gin.H, error) {
+	var q *selectData
+	m, ok := GetModel(rel.Table)
+	if ok {
+		q = m.Select()
+	} else {
+		q = Select().FromString(rel.Table)
+	}
+	var targetKey, mapKey string
+	switch rel.Type {
+	case RelationOne, RelationMany:
+		columns := rel.Columns
+		if len(columns) != 0 && !mutils.IsStringInSlice(columns, rel.ForeignKey) {
+			columns = append(columns[:len(columns):len(columns)], rel.ForeignKey)
+		}
+		q.ColumnsString(columns...)
+		targetKey, mapKey = rel.ForeignKey, FormatMapKey(rel.ForeignKey)
+	case RelationManyToMany:
+		if len(rel.JoinTable) == 0 || len(rel.JoinLocalKey) == 0 || len(rel.JoinForeignKey) == 0 {
+			return nil, fmt.Errorf("many to many no join table")
+		}
+		target := tableAlias(rel.Table)
+		join := tableAlias(rel.JoinTable)
+		columns := rel.Columns
+		if len(columns) == 0 {
+			columns = []string{target + ".*"}
+		}
+		q.ColumnsString(columns...).
+			ColumnsString(join + "." + rel.JoinLocalKey + " AS " + preloadKeyColumn).
+			Join(
+				Join(JoinTypeInner).
+					TableString(rel.JoinTable).
+					On(ConvertEqRawMake(join+"."+rel.JoinForeignKey, target+"."+rel.ForeignKey)),
+			)
+		targetKey, mapKey = join+"."+rel.JoinLocalKey, preloadKeyColumn
+	default:
+		return nil, fmt.Errorf("no relation type: %d", rel.Type)
+	}
+	q.Where(rel.Where...).
+		OrderBysString(rel.OrderBys...)
+	return selectKeys2Many(ctx, tx, q, keys, targetKey, mapKey)
+}
+
+// preloadRowsValue 写入行的值
+func preloadRowsValue(rel Relation, children []preloadNode, indexes []int) interface{} {
+	if rel.Type == RelationOne {
+		if len(indexes) == 0 {
+			return nil
+		}
+		return children[indexes[0]].row
+	}
+	rows := make([]gin.H, 0, len(indexes))
+	for _, index := range indexes {
+		rows = append(rows, children[index].row)
+	}
+	return rows
+}
+
+// preloadAttachStruct 写入结构体字段
+func preloadAttachStruct(rel Relation, sv reflect.Value, children []preloadNode, childValues []reflect.Value, indexes []int) error {
+	fv := sv.FieldByName(rel.Field)
+	if !fv.IsValid() {
+		return fmt.Errorf("no field: %s", rel.Field)
+	}
+	// value 获取子项的值,可以赋值给 t
+	value := func(index int, t reflect.Type) (reflect.Value, error) {
+		var v reflect.Value
+		if childValues[index].IsValid() {
+			v = childValues[index]
+		} else {
+			v = reflect.ValueOf(children[index].row)
+		}
+		if v.Type().AssignableTo(t) {
+			return v, nil
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Type().AssignableTo(t) {
+			return v.Elem(), nil
+		}
+		return reflect.Value{}, fmt.Errorf("field %s type not support: %s", rel.Field, fv.Type())
+	}
+	if rel.Type == RelationOne {
+		if len(indexes) == 0 {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		v, err := value(indexes[0], fv.Type())
+		if err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+	}
+	if fv.Kind() != reflect.Slice {
+		return fmt.Errorf("field %s must be slice: %s", rel.Field, fv.Type())
+	}
+	s := reflect.MakeSlice(fv.Type(), 0, len(indexes))
+	for _, index := range indexes {
+		v, err := value(index, fv.Type().Elem())
+		if err != nil {
+			return err
+		}
+		s = reflect.Append(s, v)
+	}
+	fv.Set(s)
+	return nil
+}
+
+// preloadKey 关联值转换为可比较的key,整数统一为int64,字节转换为字符串
+func preloadKey(v interface{}) (interface{}, bool) {
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return nil, false
+		}
+		v = dv
+	}
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u <= math.MaxInt64 {
+			return int64(u), true
+		}
+		return u, true
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), true
+		}
+	}
+	if rv.Type().Comparable() {
+		return rv.Interface(), true
+	}
+	return fmt.Sprint(rv.Interface()), true
+}
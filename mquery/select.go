@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/moremorefun/mtool/mdb"
@@ -20,7 +19,11 @@ type selectData struct {
 	offset       int64
 	limit        int64
 	isForUpdate  bool
+	isSkipLocked bool
 	as           string
+	dialect      Dialect
+	model        *Model
+	isUnscoped   bool
 }
 
 // Select 创建搜索
@@ -38,7 +41,7 @@ func (q *selectData) Columns(columns ...SQLAble) *selectData {
 // ColumnsString 字段
 func (q *selectData) ColumnsString(columns ...string) *selectData {
 	for _, column := range columns {
-		q.columns = append(q.columns, ConvertRaw(column))
+		q.columns = append(q.columns, ident(column))
 	}
 	return q
 }
@@ -57,7 +60,7 @@ func (q *selectData) From(from SQLAble) *selectData {
 
 // FromString 表名
 func (q *selectData) FromString(from string) *selectData {
-	q.from = ConvertRaw(from)
+	q.from = ident(from)
 	return q
 }
 
@@ -76,7 +79,7 @@ func (q *selectData) GroupBys(groupBys ...SQLAble) *selectData {
 // GroupBysString 分组
 func (q *selectData) GroupBysString(groupBys ...string) *selectData {
 	for _, groupBy := range groupBys {
-		q.groupBys = append(q.groupBys, ConvertRaw(groupBy))
+		q.groupBys = append(q.groupBys, ident(groupBy))
 	}
 	return q
 }
@@ -90,7 +93,7 @@ func (q *selectData) OrderBys(orders ...SQLAble) *selectData {
 // OrderBysString 排序
 func (q *selectData) OrderBysString(orders ...string) *selectData {
 	for _, order := range orders {
-		q.orderByParts = append(q.orderByParts, ConvertRaw(order))
+		q.orderByParts = append(q.orderByParts, ident(order))
 	}
 	return q
 }
@@ -119,15 +122,66 @@ func (q *selectData) ForUpdate() *selectData {
 	return q
 }
 
+// SkipLocked 加锁并跳过已锁定的行
+func (q *selectData) SkipLocked() *selectData {
+	q.isForUpdate = true
+	q.isSkipLocked = true
+	return q
+}
+
+// Dialect 设置方言,默认使用 SetDefaultDialect 设置的方言
+func (q *selectData) Dialect(d Dialect) *selectData {
+	q.dialect = d
+	return q
+}
+
+// Unscoped 通过模型创建时不过滤已软删除的行
+func (q *selectData) Unscoped() *selectData {
+	q.isUnscoped = true
+	return q
+}
+
+// getWhereParts 获取条件,通过模型创建时添加未删除条件
+func (q *selectData) getWhereParts() []SQLAble {
+	if q.model == nil || !q.model.isSoftDelete() || q.isUnscoped {
+		return q.whereParts
+	}
+	table := q.model.Table()
+	switch from := q.from.(type) {
+	case ConvertRaw:
+		table = string(from)
+	case ident:
+		table = string(from)
+	}
+	cond := q.model.notDeletedCond(table, len(q.joins) > 0)
+	return append(q.whereParts[:len(q.whereParts):len(q.whereParts)], cond)
+}
+
+// getDialect 获取方言
+func (q *selectData) getDialect() Dialect {
+	if q.dialect == nil {
+		return defaultDialect
+	}
+	return q.dialect
+}
+
 // As 设置为as
 func (q *selectData) As(newName string) *selectData {
 	q.as = newName
 	return q
 }
 
+// appendSubQuery 作为子查询写入,忽略As
+func (q *selectData) appendSubQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	sub := *q
+	sub.as = ""
+	return sub.AppendToQuery(buf, arg)
+}
+
 // AppendToQuery 添加输入
 func (q *selectData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
 	var err error
+	d := q.getDialect()
 	if len(q.as) > 0 {
 		buf.WriteString("(\n")
 	}
@@ -141,7 +195,7 @@ func (q *selectData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, g
 			if err != nil {
 				return bytes.Buffer{}, nil, err
 			}
-			buf, arg, err = column.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, column)
 			if err != nil {
 				return bytes.Buffer{}, nil, err
 			}
@@ -155,27 +209,28 @@ func (q *selectData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, g
 		return bytes.Buffer{}, nil, fmt.Errorf("select no from")
 	}
 	buf.WriteString("\nFROM\n    ")
-	buf, arg, err = q.from.AppendToQuery(buf, arg)
+	buf, arg, err = appendPart(buf, arg, d, q.from)
 	if err != nil {
 		return bytes.Buffer{}, nil, err
 	}
 	if len(q.joins) > 0 {
 		for _, join := range q.joins {
 			buf.WriteString("\n")
-			buf, arg, err = join.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, join)
 			if err != nil {
 				return bytes.Buffer{}, nil, err
 			}
 		}
 	}
-	if len(q.whereParts) > 0 {
+	whereParts := q.getWhereParts()
+	if len(whereParts) > 0 {
 		buf.WriteString("\nWHERE")
-		for i, where := range q.whereParts {
+		for i, where := range whereParts {
 			buf.WriteString("\n    ")
 			if i != 0 {
 				buf.WriteString("AND ")
 			}
-			buf, arg, err = where.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, where)
 			if err != nil {
 				return bytes.Buffer{}, nil, err
 			}
@@ -187,7 +242,7 @@ func (q *selectData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, g
 			if i != 0 {
 				buf.WriteString(", ")
 			}
-			buf, arg, err = groupBy.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, groupBy)
 			if err != nil {
 				return bytes.Buffer{}, nil, err
 			}
@@ -199,25 +254,24 @@ func (q *selectData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, g
 			if i != 0 {
 				buf.WriteString(", ")
 			}
-			buf, arg, err = orderByPart.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, orderByPart)
 			if err != nil {
 				return bytes.Buffer{}, nil, err
 			}
 		}
 	}
-	if q.limit > 0 {
-		if q.offset > 0 {
-			buf.WriteString("\nLIMIT ")
-			buf.WriteString(strconv.FormatInt(q.offset, 10))
-			buf.WriteString(", ")
-			buf.WriteString(strconv.FormatInt(q.limit, 10))
-		} else {
-			buf.WriteString("\nLIMIT ")
-			buf.WriteString(strconv.FormatInt(q.limit, 10))
-		}
+	limitSQL := d.LimitSQL(q.limit, q.offset)
+	if len(limitSQL) > 0 {
+		buf.WriteString("\n")
+		buf.WriteString(limitSQL)
 	}
 	if q.isForUpdate {
-		buf.WriteString("\nFOR UPDATE")
+		lockSQL, err := d.LockSQL(q.isSkipLocked)
+		if err != nil {
+			return bytes.Buffer{}, nil, err
+		}
+		buf.WriteString("\n")
+		buf.WriteString(lockSQL)
 	}
 	if len(q.as) > 0 {
 		buf.WriteString("\n) AS ")
@@ -304,3 +358,40 @@ func (q *selectData) Rows(ctx context.Context, tx mdb.ExecuteAble) ([]gin.H, err
 	}
 	return mdb.RowsContent(ctx, tx, query, arg)
 }
+
+// DoScanOne 获取数据,按db标签写入结构体
+func (q *selectData) DoScanOne(ctx context.Context, tx mdb.ExecuteAble, dest interface{}) (bool, error) {
+	query, arg, err := q.Limit(1).ToSQL()
+	if err == ErrInValueLenZero {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mdb.ScanContent(
+		ctx,
+		tx,
+		dest,
+		query,
+		arg,
+	)
+}
+
+// DoScan 获取数据,按db标签写入结构体切片
+func (q *selectData) DoScan(ctx context.Context, tx mdb.ExecuteAble, dest interface{}) error {
+	query, arg, err := q.ToSQL()
+	if err == ErrInValueLenZero {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = mdb.ScanContent(
+		ctx,
+		tx,
+		dest,
+		query,
+		arg,
+	)
+	return err
+}
@@ -0,0 +1,367 @@
+package mquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/moremorefun/mtool/mdb"
+)
+
+// buildSQL 生成sql
+func buildSQL(s SQLAble) (string, gin.H, error) {
+	var err error
+	var buf bytes.Buffer
+	arg := gin.H{}
+
+	buf, arg, err = s.AppendToQuery(buf, arg)
+	if err != nil {
+		return "", nil, err
+	}
+	return buf.String(), arg, nil
+}
+
+// doRows 执行查询返回多行
+func doRows(ctx context.Context, tx mdb.ExecuteAble, s SQLAble) ([]gin.H, error) {
+	query, arg, err := buildSQL(s)
+	if err == ErrInValueLenZero {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mdb.RowsContent(ctx, tx, query, arg)
+}
+
+// doSelect 执行查询写入 dest
+func doSelect(ctx context.Context, tx mdb.ExecuteAble, s SQLAble, dest interface{}) error {
+	query, arg, err := buildSQL(s)
+	if err == ErrInValueLenZero {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return mdb.SelectContent(ctx, tx, dest, query, arg)
+}
+
+// doScan 执行查询按db标签写入 dest
+func doScan(ctx context.Context, tx mdb.ExecuteAble, s SQLAble, dest interface{}) error {
+	query, arg, err := buildSQL(s)
+	if err == ErrInValueLenZero {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = mdb.ScanContent(ctx, tx, dest, query, arg)
+	return err
+}
+
+type unionData struct {
+	parts        []SQLAble
+	isAlls       []bool
+	orderByParts []SQLAble
+	offset       int64
+	limit        int64
+	as           string
+	dialect      Dialect
+}
+
+// Union 合并查询 UNION,子查询的As会被忽略
+func Union(selects ...SQLAble) *unionData {
+	var q unionData
+	for _, s := range selects {
+		q.Union(s)
+	}
+	return &q
+}
+
+// UnionAll 合并查询 UNION ALL,子查询的As会被忽略
+func UnionAll(selects ...SQLAble) *unionData {
+	var q unionData
+	for _, s := range selects {
+		q.UnionAll(s)
+	}
+	return &q
+}
+
+// Union 添加 UNION 查询
+func (q *unionData) Union(s SQLAble) *unionData {
+	q.parts = append(q.parts, s)
+	q.isAlls = append(q.isAlls, false)
+	return q
+}
+
+// UnionAll 添加 UNION ALL 查询
+func (q *unionData) UnionAll(s SQLAble) *unionData {
+	q.parts = append(q.parts, s)
+	q.isAlls = append(q.isAlls, true)
+	return q
+}
+
+// OrderBys 合并结果排序
+func (q *unionData) OrderBys(orders ...SQLAble) *unionData {
+	q.orderByParts = append(q.orderByParts, orders...)
+	return q
+}
+
+// OrderBysString 合并结果排序
+func (q *unionData) OrderBysString(orders ...string) *unionData {
+	for _, order := range orders {
+		q.orderByParts = append(q.orderByParts, ConvertRaw(order))
+	}
+	return q
+}
+
+// Limit 合并结果限制
+func (q *unionData) Limit(limit int64) *unionData {
+	q.limit = limit
+	return q
+}
+
+// Offset 合并结果偏移
+func (q *unionData) Offset(offset int64) *unionData {
+	q.offset = offset
+	return q
+}
+
+// As 设置为as,用于 From 和 Join
+func (q *unionData) As(newName string) *unionData {
+	q.as = newName
+	return q
+}
+
+// Dialect 设置方言,默认使用 SetDefaultDialect 设置的方言
+func (q *unionData) Dialect(d Dialect) *unionData {
+	q.dialect = d
+	return q
+}
+
+// appendSubQuery 作为子查询写入,忽略As
+func (q *unionData) appendSubQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	sub := *q
+	sub.as = ""
+	return sub.AppendToQuery(buf, arg)
+}
+
+// AppendToQuery 添加输入
+func (q *unionData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	var err error
+	if len(q.parts) < 2 {
+		return bytes.Buffer{}, nil, fmt.Errorf("union need at least 2 selects")
+	}
+	d := q.dialect
+	if d == nil {
+		d = defaultDialect
+	}
+	if len(q.as) > 0 {
+		buf.WriteString("(\n")
+	}
+	for i, part := range q.parts {
+		if i != 0 {
+			if q.isAlls[i] {
+				buf.WriteString("\nUNION ALL\n")
+			} else {
+				buf.WriteString("\nUNION\n")
+			}
+		}
+		// 有排序或分页的子查询需要括号,不支持括号时作为子查询
+		part = withDialect(d, part)
+		s, ok := part.(*selectData)
+		isParens := ok && (len(s.orderByParts) > 0 || s.limit > 0)
+		if isParens {
+			if d.IsSupportUnionParens() {
+				buf.WriteString("(\n")
+			} else {
+				buf.WriteString("SELECT * FROM (\n")
+			}
+		}
+		// 子查询的As不生效
+		sub, ok := part.(subQueryAble)
+		if ok {
+			buf, arg, err = sub.appendSubQuery(buf, arg)
+		} else {
+			buf, arg, err = part.AppendToQuery(buf, arg)
+		}
+		if err != nil {
+			return bytes.Buffer{}, nil, err
+		}
+		if isParens {
+			buf.WriteString("\n)")
+		}
+	}
+	if len(q.orderByParts) > 0 {
+		buf.WriteString("\nORDER BY\n    ")
+		for i, orderByPart := range q.orderByParts {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			buf, arg, err = appendPart(buf, arg, d, orderByPart)
+			if err != nil {
+				return bytes.Buffer{}, nil, err
+			}
+		}
+	}
+	limitSQL := d.LimitSQL(q.limit, q.offset)
+	if len(limitSQL) > 0 {
+		buf.WriteString("\n")
+		buf.WriteString(limitSQL)
+	}
+	if len(q.as) > 0 {
+		buf.WriteString("\n) AS ")
+		buf.WriteString(q.as)
+	}
+	return buf, arg, nil
+}
+
+// ToSQL 生成sql
+func (q *unionData) ToSQL() (string, gin.H, error) {
+	return buildSQL(q)
+}
+
+// DoSelect 获取数据
+func (q *unionData) DoSelect(ctx context.Context, tx mdb.ExecuteAble, dest interface{}) error {
+	return doSelect(ctx, tx, q, dest)
+}
+
+// DoScan 获取数据,按db标签写入结构体切片
+func (q *unionData) DoScan(ctx context.Context, tx mdb.ExecuteAble, dest interface{}) error {
+	return doScan(ctx, tx, q, dest)
+}
+
+// Rows 获取数据
+func (q *unionData) Rows(ctx context.Context, tx mdb.ExecuteAble) ([]gin.H, error) {
+	return doRows(ctx, tx, q)
+}
+
+// cteData 公共表表达式
+type cteData struct {
+	name    string
+	columns []string
+	query   SQLAble
+}
+
+type withData struct {
+	isRecursive bool
+	ctes        []cteData
+	query       SQLAble
+	as          string
+}
+
+// With 公共表表达式 WITH name (columns) AS (query)
+func With(name string, query SQLAble, columns ...string) *withData {
+	var q withData
+	return q.With(name, query, columns...)
+}
+
+// WithRecursive 递归公共表表达式 WITH RECURSIVE
+func WithRecursive(name string, query SQLAble, columns ...string) *withData {
+	q := withData{
+		isRecursive: true,
+	}
+	return q.With(name, query, columns...)
+}
+
+// With 添加公共表表达式
+func (q *withData) With(name string, query SQLAble, columns ...string) *withData {
+	q.ctes = append(q.ctes, cteData{
+		name:    name,
+		columns: columns,
+		query:   query,
+	})
+	return q
+}
+
+// Select 主查询
+func (q *withData) Select(query SQLAble) *withData {
+	q.query = query
+	return q
+}
+
+// As 设置为as,用于 From 和 Join
+func (q *withData) As(newName string) *withData {
+	q.as = newName
+	return q
+}
+
+// appendSubQuery 作为子查询写入,忽略As
+func (q *withData) appendSubQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	sub := *q
+	sub.as = ""
+	return sub.AppendToQuery(buf, arg)
+}
+
+// AppendToQuery 添加输入
+func (q *withData) AppendToQuery(buf bytes.Buffer, arg gin.H) (bytes.Buffer, gin.H, error) {
+	var err error
+	if len(q.ctes) == 0 {
+		return bytes.Buffer{}, nil, fmt.Errorf("with no cte")
+	}
+	if q.query == nil {
+		return bytes.Buffer{}, nil, fmt.Errorf("with no select")
+	}
+	if len(q.as) > 0 {
+		buf.WriteString("(\n")
+	}
+	buf.WriteString("WITH ")
+	if q.isRecursive {
+		buf.WriteString("RECURSIVE ")
+	}
+	for i, cte := range q.ctes {
+		if i != 0 {
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(cte.name)
+		if len(cte.columns) > 0 {
+			buf.WriteString(" (")
+			for j, column := range cte.columns {
+				if j != 0 {
+					buf.WriteString(", ")
+				}
+				buf.WriteString(column)
+			}
+			buf.WriteString(")")
+		}
+		buf.WriteString(" AS (\n")
+		if cte.query == nil {
+			return bytes.Buffer{}, nil, fmt.Errorf("with cte no query: %s", cte.name)
+		}
+		buf, arg, err = cte.query.AppendToQuery(buf, arg)
+		if err != nil {
+			return bytes.Buffer{}, nil, err
+		}
+		buf.WriteString("\n)")
+	}
+	buf.WriteString("\n")
+	buf, arg, err = q.query.AppendToQuery(buf, arg)
+	if err != nil {
+		return bytes.Buffer{}, nil, err
+	}
+	if len(q.as) > 0 {
+		buf.WriteString("\n) AS ")
+		buf.WriteString(q.as)
+	}
+	return buf, arg, nil
+}
+
+// ToSQL 生成sql
+func (q *withData) ToSQL() (string, gin.H, error) {
+	return buildSQL(q)
+}
+
+// DoSelect 获取数据
+func (q *withData) DoSelect(ctx context.Context, tx mdb.ExecuteAble, dest interface{}) error {
+	return doSelect(ctx, tx, q, dest)
+}
+
+// DoScan 获取数据,按db标签写入结构体切片
+func (q *withData) DoScan(ctx context.Context, tx mdb.ExecuteAble, dest interface{}) error {
+	return doScan(ctx, tx, q, dest)
+}
+
+// Rows 获取数据
+func (q *withData) Rows(ctx context.Context, tx mdb.ExecuteAble) ([]gin.H, error) {
+	return doRows(ctx, tx, q)
+}
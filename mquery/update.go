@@ -10,9 +10,17 @@ import (
 )
 
 type updateData struct {
-	table       string
-	updateParts []SQLAble
-	whereParts  []SQLAble
+	table        string
+	joins        []SQLAble
+	updateParts  []SQLAble
+	whereParts   []SQLAble
+	orderByParts []SQLAble
+	limit        int64
+	dialect      Dialect
+	model        *Model
+	isUnscoped   bool
+	versionCol   string
+	version      interface{}
 }
 
 // Update 创建更新
@@ -39,6 +47,52 @@ func (q *updateData) Where(whereParts ...SQLAble) *updateData {
 	return q
 }
 
+// Join 链接,多表更新时不能使用排序和限制
+func (q *updateData) Join(join ...SQLAble) *updateData {
+	q.joins = append(q.joins, join...)
+	return q
+}
+
+// OrderBys 排序
+func (q *updateData) OrderBys(orders ...SQLAble) *updateData {
+	q.orderByParts = append(q.orderByParts, orders...)
+	return q
+}
+
+// OrderBysString 排序
+func (q *updateData) OrderBysString(orders ...string) *updateData {
+	for _, order := range orders {
+		q.orderByParts = append(q.orderByParts, ident(order))
+	}
+	return q
+}
+
+// Limit 限制
+func (q *updateData) Limit(limit int64) *updateData {
+	q.limit = limit
+	return q
+}
+
+// Dialect 设置方言,默认使用 SetDefaultDialect 设置的方言
+func (q *updateData) Dialect(d Dialect) *updateData {
+	q.dialect = d
+	return q
+}
+
+// Unscoped 通过模型创建时不过滤已软删除的行
+func (q *updateData) Unscoped() *updateData {
+	q.isUnscoped = true
+	return q
+}
+
+// getDialect 获取方言
+func (q *updateData) getDialect() Dialect {
+	if q.dialect == nil {
+		return defaultDialect
+	}
+	return q.dialect
+}
+
 // ToSQL 生成sql
 func (q *updateData) ToSQL() (string, gin.H, error) {
 	var err error
@@ -49,15 +103,36 @@ func (q *updateData) ToSQL() (string, gin.H, error) {
 	if len(q.table) == 0 {
 		return "", nil, fmt.Errorf("update no table")
 	}
-	buf.WriteString(q.table)
+	d := q.getDialect()
+	buf.WriteString(quoteIdent(d, q.table))
+	if len(q.joins) > 0 && (len(q.orderByParts) > 0 || q.limit > 0) {
+		return "", nil, fmt.Errorf("multi-table update not support order by or limit")
+	}
+	buf, arg, err = appendJoins(buf, arg, d, q.joins)
+	if err != nil {
+		return "", nil, err
+	}
 	buf.WriteString("\nSET")
 	if len(q.updateParts) == 0 {
 		return "", nil, fmt.Errorf("update set empty")
 	}
-	lastUpdateIndex := len(q.updateParts) - 1
-	for i, updatePart := range q.updateParts {
+	updateParts := q.updateParts
+	whereParts := q.whereParts
+	if len(q.versionCol) > 0 {
+		updateParts = append(updateParts[:len(updateParts):len(updateParts)], ConvertAddMake(q.versionCol, 1))
+		whereParts = append(whereParts[:len(whereParts):len(whereParts)], ConvertEqMake(q.versionCol, q.version))
+	}
+	if q.model != nil {
+		isQualify := len(q.joins) > 0
+		updateParts = q.model.fillUpdate(q.table, updateParts, isQualify)
+		if q.model.isSoftDelete() && !q.isUnscoped {
+			whereParts = append(whereParts[:len(whereParts):len(whereParts)], q.model.notDeletedCond(q.table, isQualify))
+		}
+	}
+	lastUpdateIndex := len(updateParts) - 1
+	for i, updatePart := range updateParts {
 		buf.WriteString("\n    ")
-		buf, arg, err = updatePart.AppendToQuery(buf, arg)
+		buf, arg, err = appendPart(buf, arg, d, updatePart)
 		if err != nil {
 			return "", nil, err
 		}
@@ -65,19 +140,23 @@ func (q *updateData) ToSQL() (string, gin.H, error) {
 			buf.WriteString(",")
 		}
 	}
-	if len(q.whereParts) > 0 {
+	if len(whereParts) > 0 {
 		buf.WriteString("\nWHERE")
-		for i, where := range q.whereParts {
+		for i, where := range whereParts {
 			buf.WriteString("\n    ")
 			if i != 0 {
 				buf.WriteString("AND ")
 			}
-			buf, arg, err = where.AppendToQuery(buf, arg)
+			buf, arg, err = appendPart(buf, arg, d, where)
 			if err != nil {
 				return "", nil, err
 			}
 		}
 	}
+	buf, arg, err = appendOrderLimit(buf, arg, d, q.orderByParts, q.limit)
+	if err != nil {
+		return "", nil, err
+	}
 	return buf.String(), arg, nil
 }
 
@@ -94,3 +173,51 @@ func (q *updateData) DoExecuteCount(ctx context.Context, tx mdb.ExecuteAble) (in
 		arg,
 	)
 }
+
+// appendJoins 添加更新删除的链接
+func appendJoins(buf bytes.Buffer, arg gin.H, d Dialect, joins []SQLAble) (bytes.Buffer, gin.H, error) {
+	var err error
+	if len(joins) == 0 {
+		return buf, arg, nil
+	}
+	if !d.IsSupportUpdateJoinLimit() {
+		return bytes.Buffer{}, nil, fmt.Errorf("%s not support join in update or delete", d.Name())
+	}
+	for _, join := range joins {
+		buf.WriteString("\n")
+		buf, arg, err = appendPart(buf, arg, d, join)
+		if err != nil {
+			return bytes.Buffer{}, nil, err
+		}
+	}
+	return buf, arg, nil
+}
+
+// appendOrderLimit 添加更新删除的排序和限制
+func appendOrderLimit(buf bytes.Buffer, arg gin.H, d Dialect, orderByParts []SQLAble, limit int64) (bytes.Buffer, gin.H, error) {
+	var err error
+	if len(orderByParts) == 0 && limit <= 0 {
+		return buf, arg, nil
+	}
+	if !d.IsSupportUpdateJoinLimit() {
+		return bytes.Buffer{}, nil, fmt.Errorf("%s not support order by or limit in update or delete", d.Name())
+	}
+	if len(orderByParts) > 0 {
+		buf.WriteString("\nORDER BY\n    ")
+		for i, orderByPart := range orderByParts {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			buf, arg, err = appendPart(buf, arg, d, orderByPart)
+			if err != nil {
+				return bytes.Buffer{}, nil, err
+			}
+		}
+	}
+	limitSQL := d.LimitSQL(limit, 0)
+	if len(limitSQL) > 0 {
+		buf.WriteString("\n")
+		buf.WriteString(limitSQL)
+	}
+	return buf, arg, nil
+}
@@ -2,11 +2,13 @@ package mredis
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/moremorefun/mtool/mlog"
+	"github.com/moremorefun/mtool/mutils"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -14,21 +16,72 @@ import (
 // baseKey 基础key
 var baseKey = ""
 
+// Options 链接选项
+type Options struct {
+	Password string
+	DB       int
+	// PoolSize 链接池大小,默认 NumCPU*10
+	PoolSize int
+	// MinIdleConns 最小空闲链接数
+	MinIdleConns int
+	// IdleTimeout 空闲链接关闭时间,默认5分钟
+	IdleTimeout time.Duration
+	// DialTimeout 链接超时,默认5秒
+	DialTimeout time.Duration
+	// ConnectRetries 链接失败后的重试次数
+	ConnectRetries int
+	// RetryBackoff 首次重试等待时间,之后每次翻倍,默认1s
+	RetryBackoff time.Duration
+	// TLSConfig 使用TLS链接
+	TLSConfig *tls.Config
+	// ReadyTimeout 启动时等待redis可用的最长时间,超时后不再重试
+	ReadyTimeout time.Duration
+}
+
 // Create 创建数据库
 func Create(address string, password string, dbIndex int) *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: password, // no password set
-		DB:       dbIndex,  // use default DB
+	client, err := Open(context.Background(), address, Options{
+		Password: password,
+		DB:       dbIndex,
 	})
-	_, err := client.Ping(context.Background()).Result()
 	if err != nil {
-		mlog.Log.Fatalf("redis ping error: %s", err.Error())
+		mlog.Log.Fatalf("%s", err.Error())
 		return nil
 	}
 	return client
 }
 
+// Open 创建链接,失败时返回错误
+func Open(ctx context.Context, address string, opts Options) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         address,
+		Password:     opts.Password,
+		DB:           opts.DB,
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: opts.MinIdleConns,
+		IdleTimeout:  opts.IdleTimeout,
+		DialTimeout:  opts.DialTimeout,
+		TLSConfig:    opts.TLSConfig,
+	})
+	if opts.ReadyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ReadyTimeout)
+		defer cancel()
+	}
+	err := mutils.Retry(ctx, opts.ConnectRetries, opts.RetryBackoff, func() error {
+		_, err := client.Ping(ctx).Result()
+		if err != nil {
+			mlog.Log.Warnf("redis ping error: %s", err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("redis ping error: %w", err)
+	}
+	return client, nil
+}
+
 // SetBaseKey 设置基础key
 func SetBaseKey(v string) {
 	baseKey = v
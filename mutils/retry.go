@@ -0,0 +1,37 @@
+package mutils
+
+import (
+	"context"
+	"time"
+)
+
+// maxRetryBackoff 最长重试间隔
+const maxRetryBackoff = 30 * time.Second
+
+// Retry 执行 f 直到成功
+// 失败后等待 backoff 并翻倍,最多重试 retries 次,ctx 结束时提前返回
+func Retry(ctx context.Context, retries int, backoff time.Duration, f func() error) error {
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}